@@ -44,15 +44,7 @@ func NewLoadBalancer(numWorkers uint8) *Balancer {
 		done:    make(chan *Worker, numWorkers),
 	}
 	for i := uint8(0); i < numWorkers; i++ {
-		b.workers[i] = &Worker{
-			mask:     1 << i,
-			index:    i,
-			spList:   make(SPList, 0, MAX_DEPTH),
-			stk:      NewStack(),
-			ptt:      NewPawnTT(),
-			assignSp: make(chan *SplitPoint, 1),
-			recycler: NewRecycler(512),
-		}
+		b.workers[i] = NewWorker(i)
 	}
 	return b
 }
@@ -81,6 +73,12 @@ func (b *Balancer) Overhead() int {
 	return overhead
 }
 
+func (b *Balancer) ClearKillers() {
+	for _, w := range b.workers {
+		w.stk.ClearKillers()
+	}
+}
+
 func (b *Balancer) RootWorker() *Worker {
 	return b.workers[0]
 }
@@ -10,7 +10,8 @@ import (
 )
 
 const (
-	ANY_SQUARE_MASK = (1 << 64) - 1
+	ANY_SQUARE_MASK    = (1 << 64) - 1
+	LIGHT_SQUARES_MASK = 0x55AA55AA55AA55AA
 )
 
 type BB uint64
@@ -39,15 +39,11 @@ var oppositeDir = [16]int{SE, SW, NW, NE, SOUTH, WEST, NORTH, EAST, DIR_INVALID}
 
 var rowMasks, columnMasks [8]BB
 
-var castleMasks [16]BB
-
 var pawnIsolatedMasks, pawnSideMasks, pawnDoubledMasks, knightMasks, bishopMasks, rookMasks,
 	queenMasks, kingMasks, sqMaskOn, sqMaskOff [64]BB
 
 var intervening, lineMasks [64][64]BB
 
-var castleQueensideIntervening, castleKingsideIntervening [2]BB
-
 var pawnAttackMasks, pawnPassedMasks, pawnAttackSpans, pawnBackwardSpans, pawnFrontSpans,
 	pawnStopMasks, kingZoneMasks, kingShieldMasks [2][64]BB
 
@@ -55,6 +51,8 @@ var rayMasks [8][64]BB
 
 var pawnStopSq, pawnPromoteSq [2][64]int
 
+var outpostMasks, spaceMasks [2]BB
+
 func manhattanDistance(from, to int) int {
 	return abs(row(from)-row(to)) + abs(column(from)-column(to))
 }
@@ -237,28 +235,13 @@ func setupPawnStructureMasks() {
 		pawnPromoteSq[WHITE][i] = msb(pawnFrontSpans[WHITE][i])
 		pawnPromoteSq[BLACK][i] = lsb(pawnFrontSpans[BLACK][i])
 	}
-}
-
-func setupCastleMasks() {
-	castleQueensideIntervening[WHITE] |= (sqMaskOn[B1] | sqMaskOn[C1] | sqMaskOn[D1])
-	castleKingsideIntervening[WHITE] |= (sqMaskOn[F1] | sqMaskOn[G1])
-	castleQueensideIntervening[BLACK] = (castleQueensideIntervening[WHITE] << 56)
-	castleKingsideIntervening[BLACK] = (castleKingsideIntervening[WHITE] << 56)
-
-	for i := uint8(0); i < 16; i++ {
-		if i&C_WQ > 0 {
-			castleMasks[i] |= (sqMaskOn[A1] | sqMaskOn[E1])
-		}
-		if i&C_WK > 0 {
-			castleMasks[i] |= (sqMaskOn[E1] | sqMaskOn[H1])
-		}
-		if i&C_BQ > 0 {
-			castleMasks[i] |= (sqMaskOn[A8] | sqMaskOn[E8])
-		}
-		if i&C_BK > 0 {
-			castleMasks[i] |= (sqMaskOn[E8] | sqMaskOn[H8])
-		}
-	}
+	// Outposts may occur on the 4th through 6th ranks from each side's point of view.
+	outpostMasks[WHITE] = rowMasks[3] | rowMasks[4] | rowMasks[5]
+	outpostMasks[BLACK] = rowMasks[2] | rowMasks[3] | rowMasks[4]
+	// Space is measured on the central four files of the 2nd through 4th ranks.
+	center := columnMasks[2] | columnMasks[3] | columnMasks[4] | columnMasks[5]
+	spaceMasks[WHITE] = center & (rowMasks[1] | rowMasks[2] | rowMasks[3])
+	spaceMasks[BLACK] = center & (rowMasks[4] | rowMasks[5] | rowMasks[6])
 }
 
 func setupMasks() {
@@ -273,5 +256,4 @@ func setupMasks() {
 	setupDirections()
 	setupPawnMasks()
 	setupPawnStructureMasks()
-	setupCastleMasks()
 }
@@ -20,19 +20,22 @@ var printMutex sync.Mutex
 // When spawning new goroutines for subtree search, a deep copy of the Board struct will have to be made
 // and passed to the new goroutine.  Keep this struct as small as possible.
 type Board struct {
-	pieces         [2][8]BB  // 1024 bits
-	squares        [64]Piece //  512 bits
-	occupied       [2]BB     //  128 bits
-	hashKey        uint64    //   64 bits
-	worker         *Worker   //   64 bits
-	material       [2]int16  //   32 bits
-	pawnHashKey    uint32    //   32 bits
-	c              uint8     //    8 bits
-	castle         uint8     //    8 bits
-	enpTarget      uint8     //    8 bits
-	halfmoveClock  uint8     //    8 bits
-	endgameCounter uint8     //    8 bits
-	// ...24 bits padding
+	pieces         [2][8]BB     // 1024 bits
+	squares        [64]Piece    //  512 bits
+	occupied       [2]BB        //  128 bits
+	hashKey        uint64       //   64 bits
+	worker         *Worker      //   64 bits
+	acc            *Accumulator //   64 bits (nil unless NNUE evaluation is enabled)
+	material       [2]Score     //   64 bits
+	pawnHashKey    uint32       //   32 bits
+	materialKey    uint32       //   32 bits
+	castleRooks    [2][2]uint8  //   32 bits (starting squares of the castling rooks)
+	c              uint8        //    8 bits
+	castle         uint8        //    8 bits
+	enpTarget      uint8        //    8 bits
+	halfmoveClock  uint8        //    8 bits
+	endgameCounter uint8        //    8 bits
+	// ...56 bits padding
 }
 
 type BoardMemento struct { // memento object used to store board state to unmake later.
@@ -104,6 +107,11 @@ func (brd *Board) ColorPawnsOnly(c uint8) bool {
 }
 
 func (brd *Board) Copy() *Board {
+	return brd.CopyWith(brd.acc.Copy())
+}
+
+// CopyWith returns a copy of brd that uses acc, which must hold the same values as brd.acc.
+func (brd *Board) CopyWith(acc *Accumulator) *Board {
 	return &Board{
 		pieces:         brd.pieces,
 		squares:        brd.squares,
@@ -111,8 +119,11 @@ func (brd *Board) Copy() *Board {
 		material:       brd.material,
 		hashKey:        brd.hashKey,
 		pawnHashKey:    brd.pawnHashKey,
+		materialKey:    brd.materialKey,
+		acc:            acc,
 		c:              brd.c,
 		castle:         brd.castle,
+		castleRooks:    brd.castleRooks,
 		enpTarget:      brd.enpTarget,
 		halfmoveClock:  brd.halfmoveClock,
 		endgameCounter: brd.endgameCounter,
@@ -124,10 +135,11 @@ func (brd *Board) PrintDetails() {
 	sideNames := [2]string{"White", "Black"}
 	printMutex.Lock()
 
-	fmt.Printf("hashKey: %x, pawnHashKey: %x\n", brd.hashKey, brd.pawnHashKey)
+	fmt.Printf("hashKey: %x, pawnHashKey: %x, materialKey: %x\n", brd.hashKey, brd.pawnHashKey,
+		brd.materialKey)
 	fmt.Printf("castle: %d, enpTarget: %d, halfmoveClock: %d\noccupied:\n", brd.castle, brd.enpTarget, brd.halfmoveClock)
 	for i := 0; i < 2; i++ {
-		fmt.Printf("side: %s, material: %d\n", sideNames[i], brd.material[i])
+		fmt.Printf("side: %s, material: %d/%d\n", sideNames[i], brd.material[i].MG(), brd.material[i].EG())
 		brd.occupied[i].Print()
 		for pc := 0; pc < 6; pc++ {
 			fmt.Printf("%s\n", pieceNames[pc])
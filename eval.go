@@ -5,11 +5,6 @@
 
 package main
 
-const ( // TODO: expose these options via UCI interface.
-	LAZY_EVAL_MARGIN = BISHOP_VALUE
-	TEMPO_BONUS      = 5
-)
-
 const (
 	MAX_ENDGAME_COUNT = 24
 )
@@ -19,6 +14,28 @@ const (
 	ENDGAME
 )
 
+// Score packs a midgame and an endgame value into a single integer, so that evaluation terms
+// can be summed using ordinary integer arithmetic and blended only once at the end of evaluate().
+// The midgame value is stored in the lower 16 bits, and the endgame value in the upper 16 bits.
+type Score int32
+
+func S(mg, eg int) Score {
+	return Score(int32(uint32(eg)<<16) + int32(mg))
+}
+
+func (s Score) MG() int {
+	return int(int16(uint16(uint32(s))))
+}
+
+func (s Score) EG() int {
+	return int(int16(uint16((uint32(s) + 0x8000) >> 16)))
+}
+
+// Taper blends the midgame and endgame values of s based on the current game phase.
+func (s Score) Taper(phase int) int {
+	return weightScore(phase, s.MG(), s.EG())
+}
+
 var chebyshevDistanceTable [64][64]int
 
 func chebyshevDistance(from, to int) int {
@@ -39,78 +56,84 @@ var endgamePhase [64]int
 // piece values used to determine endgame status. 0-12 per side,
 var endgameCountValues = [8]uint8{0, 1, 1, 2, 4, 0}
 
-var mainPst = [2][8][64]int{ // Black. White PST will be set in setup_eval.
-	{ // Pawn
-		{0, 0, 0, 0, 0, 0, 0, 0,
-			-11, 1, 1, 1, 1, 1, 1, -11,
-			-12, 0, 1, 2, 2, 1, 0, -12,
-			-13, -1, 2, 10, 10, 2, -1, -13,
-			-14, -2, 4, 14, 14, 4, -2, -14,
-			-15, -3, 0, 9, 9, 0, -3, -15,
-			-16, -4, 0, -20, -20, 0, -4, -16,
-			0, 0, 0, 0, 0, 0, 0, 0},
+// material values used by the evaluation. Piece values used for move ordering and SEE are given
+// by pieceValues.
+var materialScores = [8]Score{S(PAWN_VALUE, PAWN_VALUE), S(KNIGHT_VALUE, KNIGHT_VALUE),
+	S(BISHOP_VALUE, BISHOP_VALUE), S(ROOK_VALUE, ROOK_VALUE), S(QUEEN_VALUE, QUEEN_VALUE)}
 
+var mainPst = [2][8][64]Score{ // Black. White PST will be set in setup_eval.
+	{
+		// Pawn
+		{
+			S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0),
+			S(-11, -11), S(1, 1), S(1, 1), S(1, 1), S(1, 1), S(1, 1), S(1, 1), S(-11, -11),
+			S(-12, -12), S(0, 0), S(1, 1), S(2, 2), S(2, 2), S(1, 1), S(0, 0), S(-12, -12),
+			S(-13, -13), S(-1, -1), S(2, 2), S(10, 10), S(10, 10), S(2, 2), S(-1, -1), S(-13, -13),
+			S(-14, -14), S(-2, -2), S(4, 4), S(14, 14), S(14, 14), S(4, 4), S(-2, -2), S(-14, -14),
+			S(-15, -15), S(-3, -3), S(0, 0), S(9, 9), S(9, 9), S(0, 0), S(-3, -3), S(-15, -15),
+			S(-16, -16), S(-4, -4), S(0, 0), S(-20, -20), S(-20, -20), S(0, 0), S(-4, -4), S(-16, -16),
+			S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0),
+		},
 		// Knight
-		{-8, -8, -6, -6, -6, -6, -8, -8,
-			-8, 0, 0, 0, 0, 0, 0, -8,
-			-6, 0, 4, 4, 4, 4, 0, -6,
-			-6, 0, 4, 8, 8, 4, 0, -6,
-			-6, 0, 4, 8, 8, 4, 0, -6,
-			-6, 0, 4, 4, 4, 4, 0, -6,
-			-8, 0, 1, 2, 2, 1, 0, -8,
-			-10, -12, -6, -6, -6, -6, -12, -10},
+		{
+			S(-8, -8), S(-8, -8), S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6), S(-8, -8), S(-8, -8),
+			S(-8, -8), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-8, -8),
+			S(-6, -6), S(0, 0), S(4, 4), S(4, 4), S(4, 4), S(4, 4), S(0, 0), S(-6, -6),
+			S(-6, -6), S(0, 0), S(4, 4), S(8, 8), S(8, 8), S(4, 4), S(0, 0), S(-6, -6),
+			S(-6, -6), S(0, 0), S(4, 4), S(8, 8), S(8, 8), S(4, 4), S(0, 0), S(-6, -6),
+			S(-6, -6), S(0, 0), S(4, 4), S(4, 4), S(4, 4), S(4, 4), S(0, 0), S(-6, -6),
+			S(-8, -8), S(0, 0), S(1, 1), S(2, 2), S(2, 2), S(1, 1), S(0, 0), S(-8, -8),
+			S(-10, -10), S(-12, -12), S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6), S(-12, -12), S(-10, -10),
+		},
 		// Bishop
-		{-3, -3, -3, -3, -3, -3, -3, -3,
-			-3, 0, 0, 0, 0, 0, 0, -3,
-			-3, 0, 2, 4, 4, 2, 0, -3,
-			-3, 0, 4, 5, 5, 4, 0, -3,
-			-3, 0, 4, 5, 5, 4, 0, -3,
-			-3, 1, 2, 4, 4, 2, 1, -3,
-			-3, 2, 1, 1, 1, 1, 2, -3,
-			-3, -3, -10, -3, -3, -10, -3, -3},
+		{
+			S(-3, -3), S(-3, -3), S(-3, -3), S(-3, -3), S(-3, -3), S(-3, -3), S(-3, -3), S(-3, -3),
+			S(-3, -3), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-3, -3),
+			S(-3, -3), S(0, 0), S(2, 2), S(4, 4), S(4, 4), S(2, 2), S(0, 0), S(-3, -3),
+			S(-3, -3), S(0, 0), S(4, 4), S(5, 5), S(5, 5), S(4, 4), S(0, 0), S(-3, -3),
+			S(-3, -3), S(0, 0), S(4, 4), S(5, 5), S(5, 5), S(4, 4), S(0, 0), S(-3, -3),
+			S(-3, -3), S(1, 1), S(2, 2), S(4, 4), S(4, 4), S(2, 2), S(1, 1), S(-3, -3),
+			S(-3, -3), S(2, 2), S(1, 1), S(1, 1), S(1, 1), S(1, 1), S(2, 2), S(-3, -3),
+			S(-3, -3), S(-3, -3), S(-10, -10), S(-3, -3), S(-3, -3), S(-10, -10), S(-3, -3), S(-3, -3),
+		},
 		// Rook
-		{4, 4, 4, 4, 4, 4, 4, 4,
-			16, 16, 16, 16, 16, 16, 16, 16,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			0, 0, 0, 2, 2, 0, 0, 0},
+		{
+			S(4, 4), S(4, 4), S(4, 4), S(4, 4), S(4, 4), S(4, 4), S(4, 4), S(4, 4),
+			S(16, 16), S(16, 16), S(16, 16), S(16, 16), S(16, 16), S(16, 16), S(16, 16), S(16, 16),
+			S(-4, -4), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-4, -4),
+			S(-4, -4), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-4, -4),
+			S(-4, -4), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-4, -4),
+			S(-4, -4), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-4, -4),
+			S(-4, -4), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(0, 0), S(-4, -4),
+			S(0, 0), S(0, 0), S(0, 0), S(2, 2), S(2, 2), S(0, 0), S(0, 0), S(0, 0),
+		},
 		// Queen
-		{0, 0, 0, 1, 1, 0, 0, 0,
-			0, 0, 1, 2, 2, 1, 0, 0,
-			0, 1, 2, 2, 2, 2, 1, 0,
-			0, 1, 2, 3, 3, 2, 1, 0,
-			0, 1, 2, 3, 3, 2, 1, 0,
-			0, 1, 1, 2, 2, 1, 1, 0,
-			0, 0, 1, 1, 1, 1, 0, 0,
-			-6, -6, -6, -6, -6, -6, -6, -6},
+		{
+			S(0, 0), S(0, 0), S(0, 0), S(1, 1), S(1, 1), S(0, 0), S(0, 0), S(0, 0),
+			S(0, 0), S(0, 0), S(1, 1), S(2, 2), S(2, 2), S(1, 1), S(0, 0), S(0, 0),
+			S(0, 0), S(1, 1), S(2, 2), S(2, 2), S(2, 2), S(2, 2), S(1, 1), S(0, 0),
+			S(0, 0), S(1, 1), S(2, 2), S(3, 3), S(3, 3), S(2, 2), S(1, 1), S(0, 0),
+			S(0, 0), S(1, 1), S(2, 2), S(3, 3), S(3, 3), S(2, 2), S(1, 1), S(0, 0),
+			S(0, 0), S(1, 1), S(1, 1), S(2, 2), S(2, 2), S(1, 1), S(1, 1), S(0, 0),
+			S(0, 0), S(0, 0), S(1, 1), S(1, 1), S(1, 1), S(1, 1), S(0, 0), S(0, 0),
+			S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6), S(-6, -6),
+		},
 	},
 }
 
-var kingPst = [2][2][64]int{ // Black
-	{ // Early game
-		{
-			-52, -50, -50, -50, -50, -50, -50, -52, // In early game, encourage the king to stay on back
-			-50, -48, -48, -48, -48, -48, -48, -50, // row defended by friendly pieces.
-			-48, -46, -46, -46, -46, -46, -46, -48,
-			-46, -44, -44, -44, -44, -44, -44, -46,
-			-44, -42, -42, -42, -42, -42, -42, -44,
-			-42, -40, -40, -40, -40, -40, -40, -42,
-			-16, -15, -20, -20, -20, -20, -15, -16,
-			0, 20, 30, -30, 0, -20, 30, 20,
-		},
-		{ // Endgame
-			-30, -20, -10, 0, 0, -10, -20, -30, // In end game (when few friendly pieces are available
-			-20, -10, 0, 10, 10, 0, -10, -20, // to protect king), the king should move toward the center
-			-10, 0, 10, 20, 20, 10, 0, -10, // and avoid getting trapped in corners.
-			0, 10, 20, 30, 30, 20, 10, 0,
-			0, 10, 20, 30, 30, 20, 10, 0,
-			-10, 0, 10, 20, 20, 10, 0, -10,
-			-20, -10, 0, 10, 10, 0, -10, -20,
-			-30, -20, -10, 0, 0, -10, -20, -30,
-		},
+// In early game, encourage the king to stay on back row defended by friendly pieces.
+// In end game (when few friendly pieces are available to protect king), the king should move
+// toward the center and avoid getting trapped in corners.
+var kingPst = [2][64]Score{ // Black
+	{
+		S(-52, -30), S(-50, -20), S(-50, -10), S(-50, 0), S(-50, 0), S(-50, -10), S(-50, -20), S(-52, -30),
+		S(-50, -20), S(-48, -10), S(-48, 0), S(-48, 10), S(-48, 10), S(-48, 0), S(-48, -10), S(-50, -20),
+		S(-48, -10), S(-46, 0), S(-46, 10), S(-46, 20), S(-46, 20), S(-46, 10), S(-46, 0), S(-48, -10),
+		S(-46, 0), S(-44, 10), S(-44, 20), S(-44, 30), S(-44, 30), S(-44, 20), S(-44, 10), S(-46, 0),
+		S(-44, 0), S(-42, 10), S(-42, 20), S(-42, 30), S(-42, 30), S(-42, 20), S(-42, 10), S(-44, 0),
+		S(-42, -10), S(-40, 0), S(-40, 10), S(-40, 20), S(-40, 20), S(-40, 10), S(-40, 0), S(-42, -10),
+		S(-16, -20), S(-15, -10), S(-20, 0), S(-20, 10), S(-20, 10), S(-20, 0), S(-15, -10), S(-16, -20),
+		S(0, -30), S(20, -20), S(30, -10), S(-30, 0), S(0, 0), S(-20, -10), S(30, -20), S(20, -30),
 	},
 }
 
@@ -125,15 +148,15 @@ var squareMirror = [64]int{
 	A1, B1, C1, D1, E1, F1, G1, H1,
 }
 
-var kingThreatBonus = [64]int{
-	0, 2, 3, 5, 9, 15, 24, 37,
-	55, 79, 111, 150, 195, 244, 293, 337,
-	370, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
+var kingThreatBonus = [64]Score{
+	S(0, 0), S(2, 0), S(3, 0), S(5, 0), S(9, 0), S(15, 0), S(24, 0), S(37, 0),
+	S(55, 0), S(79, 0), S(111, 0), S(150, 0), S(195, 0), S(244, 0), S(293, 0), S(337, 0),
+	S(370, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0),
+	S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0),
+	S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0),
+	S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0),
+	S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0),
+	S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0), S(389, 0),
 }
 
 var kingSafteyBase = [2][64]int{
@@ -150,30 +173,49 @@ var kingSafteyBase = [2][64]int{
 }
 
 // adjusts value of knights and rooks based on number of own pawns in play.
-var knightPawns = [16]int{-20, -16, -12, -8, -4, 0, 4, 8, 12}
-var rookPawns = [16]int{16, 12, 8, 4, 2, 0, -2, -4, -8}
+var knightMobility = [16]Score{S(-16, -16), S(-12, -12), S(-6, -6), S(-3, -3), S(0, 0), S(1, 1),
+	S(3, 3), S(5, 5), S(6, 6)}
 
-// adjusts the value of bishop pairs based on number of enemy pawns in play.
-var bishopPairPawns = [16]int{10, 10, 9, 8, 6, 4, 2, 0, -2}
+var bishopMobility = [16]Score{S(-24, -24), S(-16, -16), S(-8, -8), S(-4, -4), S(-2, -2), S(0, 0),
+	S(2, 2), S(4, 4), S(6, 6), S(7, 7), S(8, 8), S(9, 9), S(10, 10), S(11, 11), S(12, 12), S(13, 13)}
 
-var knightMobility = [16]int{-16, -12, -6, -3, 0, 1, 3, 5, 6, 0, 0, 0, 0, 0, 0}
+// only reward rook mobility in the late-game.
+var rookMobility = [16]Score{S(0, -12), S(0, -8), S(0, -4), S(0, -2), S(0, 0), S(0, 2), S(0, 3),
+	S(0, 4), S(0, 5), S(0, 6), S(0, 7), S(0, 8), S(0, 9), S(0, 10), S(0, 11), S(0, 12)}
 
-var bishopMobility = [16]int{-24, -16, -8, -4, -2, 0, 2, 4, 6, 7, 8, 9, 10, 11, 12, 13}
+var queenMobility = [32]Score{S(-24, -24), S(-18, -18), S(-12, -12), S(-6, -6), S(-3, -3), S(0, 0),
+	S(2, 2), S(3, 3), S(4, 4), S(5, 5), S(6, 6), S(7, 7), S(8, 8), S(9, 9), S(10, 10), S(11, 11),
+	S(12, 12), S(13, 13), S(14, 14), S(15, 15), S(16, 16), S(17, 17), S(18, 18), S(19, 19),
+	S(20, 20), S(21, 21), S(22, 22), S(23, 23), S(24, 24), S(24, 24), S(24, 24), S(24, 24)}
 
-var rookMobility = [16]int{-12, -8, -4, -2, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
-
-var queenMobility = [32]int{-24, -18, -12, -6, -3, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 24, 24, 24}
-
-var queenTropismBonus = [8]int{0, 12, 9, 6, 3, 0, -3, -6}
+// encourage queen to move toward enemy king in the late-game.
+var queenTropismBonus = [8]Score{S(0, 0), S(0, 12), S(0, 9), S(0, 6), S(0, 3), S(0, 0), S(0, -3),
+	S(0, -6)}
 
 func evaluate(brd *Board, alpha, beta int) int {
+	if brd.acc != nil { // use the NNUE evaluation when enabled.
+		return brd.acc.Evaluate(brd.c)
+	}
 	c, e := brd.c, brd.Enemy()
+
+	mentry := brd.worker.mtt.Probe(brd.materialKey)
+	if mentry.key != brd.materialKey { // material hash table miss.
+		setMaterialEntry(brd, mentry)
+	}
+	if mentry.evaluator != nil { // use the specialized evaluation for known endgames.
+		if mentry.strong == c {
+			return mentry.evaluator(brd, c)
+		}
+		return -mentry.evaluator(brd, e)
+	}
+
+	phase := mentry.phase
 	// lazy evaluation: if material balance is already outside the search window by an amount that outweighs
 	// the largest likely placement evaluation, return the material as an approximate evaluation.
 	// This prevents the engine from wasting a lot of time evaluating unrealistic positions.
-	score := int(brd.material[c]-brd.material[e]) + TEMPO_BONUS
-	if score+LAZY_EVAL_MARGIN < alpha || score-LAZY_EVAL_MARGIN > beta {
+	material := brd.material[c] - brd.material[e] + mentry.value[c]
+	score := material.Taper(phase) + searchConfig.tempoBonus
+	if score+searchConfig.lazyEvalMargin < alpha || score-searchConfig.lazyEvalMargin > beta {
 		return score
 	}
 
@@ -183,81 +225,123 @@ func evaluate(brd *Board, alpha, beta int) int {
 		setPawnStructure(brd, pentry) // evaluate pawn structure and save to pentry.
 	}
 
-	score += netPawnPlacement(brd, pentry, c, e)
-	score += netMajorPlacement(brd, pentry, c, e) // 3x as expensive as pawn eval...
+	var ai AttackInfo
+	total := material
+	total += netMajorPlacement(brd, pentry, &ai, c, e) // 3x as expensive as pawn eval...
+	total += netPawnPlacement(brd, pentry, &ai, c, e)  // uses the attack maps set by netMajorPlacement.
 
-	return score
+	// scale down the endgame score if the side that's ahead is unlikely to be able to win.
+	strong := c
+	if total.EG() < 0 {
+		strong = e
+	}
+	eg := total.EG() * int(mentry.scale[strong]) / SCALE_NORMAL
+	return weightScore(phase, total.MG(), eg) + searchConfig.tempoBonus
 }
 
-func netMajorPlacement(brd *Board, pentry *PawnEntry, c, e uint8) int {
+func netMajorPlacement(brd *Board, pentry *PawnEntry, ai *AttackInfo, c, e uint8) Score {
 	kingSq, enemyKingSq := brd.KingSq(c), brd.KingSq(e)
-	return majorPlacement(brd, pentry, c, e, kingSq, enemyKingSq) -
-		majorPlacement(brd, pentry, e, c, enemyKingSq, kingSq)
+	placement := majorPlacement(brd, pentry, ai, c, e, kingSq, enemyKingSq) -
+		majorPlacement(brd, pentry, ai, e, c, enemyKingSq, kingSq)
+	// threats can only be evaluated once the attack maps for both sides are complete.
+	return placement + threats(brd, ai, c, e) - threats(brd, ai, e, c)
 }
 
-var pawnShieldBonus = [4]int{-9, -3, 3, 9}
+var pawnShieldBonus = [4]Score{S(-9, 0), S(-3, 0), S(3, 0), S(9, 0)}
+
+var (
+	rookOpenFileBonus     = S(20, 10)
+	rookSemiOpenFileBonus = S(10, 5)
+	rookSeventhBonus      = S(10, 20)
+	knightOutpostBonus    = S(20, 10)
+	bishopOutpostBonus    = S(10, 5)
+)
+
+var secondRow = [2]int{6, 1}
+var backRow = [2]int{7, 0}
 
-func majorPlacement(brd *Board, pentry *PawnEntry, c, e uint8, kingSq,
-	enemyKingSq int) (totalPlacement int) {
+func majorPlacement(brd *Board, pentry *PawnEntry, ai *AttackInfo, c, e uint8, kingSq,
+	enemyKingSq int) (totalPlacement Score) {
 
 	friendly := brd.Placement(c)
 	occ := brd.AllOccupied()
 
 	available := (^friendly) & (^(pentry.allAttacks[e]))
 
-	var sq, mobility, placement, kingThreats int
+	var sq, kingThreats int
+	var mobility, placement Score
 	var b, attacks BB
 
 	enemyKingZone := kingZoneMasks[e][enemyKingSq]
 
-	pawnCount := pentry.count[c]
+	ai.byPiece[c][PAWN] = pentry.allAttacks[c]
+	ai.byPiece[c][KING] = kingMasks[kingSq]
 
 	for b = brd.pieces[c][KNIGHT]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
-		placement += knightPawns[pawnCount]
-		attacks = knightMasks[sq] & available
+		if sqMaskOn[sq]&pentry.outposts[c] > 0 {
+			placement += knightOutpostBonus
+		}
+		attacks = knightMasks[sq]
+		ai.byPiece[c][KNIGHT] |= attacks
+		attacks &= available
 		kingThreats += popCount(attacks & enemyKingZone)
 		mobility += knightMobility[popCount(attacks)]
 	}
 
 	for b = brd.pieces[c][BISHOP]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
-		attacks = bishopAttacks(occ, sq) & available
+		if sqMaskOn[sq]&pentry.outposts[c] > 0 {
+			placement += bishopOutpostBonus
+		}
+		attacks = bishopAttacks(occ, sq)
+		ai.byPiece[c][BISHOP] |= attacks
+		attacks &= available
 		kingThreats += popCount(attacks & enemyKingZone)
 		mobility += bishopMobility[popCount(attacks)]
-	}
-	if popCount(brd.pieces[c][BISHOP]) > 1 { // bishop pairs
-		placement += 40 + bishopPairPawns[pentry.count[e]]
+		placement += trappedBishop(brd, c, e, sq)
 	}
 
-	phase := endgamePhase[brd.endgameCounter]
-
 	for b = brd.pieces[c][ROOK]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
-		placement += rookPawns[pawnCount]
-		attacks = rookAttacks(occ, sq) & available
+		if sqMaskOn[sq]&pentry.openFiles > 0 {
+			placement += rookOpenFileBonus
+		} else if sqMaskOn[sq]&pentry.semiOpen[c] > 0 {
+			placement += rookSemiOpenFileBonus
+		}
+		// rooks on the 7th rank are most effective when they restrict the enemy king or attack
+		// enemy pawns that have not yet advanced.
+		if row(sq) == secondRow[e] && (row(enemyKingSq) == backRow[e] ||
+			brd.pieces[e][PAWN]&rowMasks[secondRow[e]] > 0) {
+			placement += rookSeventhBonus
+		}
+		attacks = rookAttacks(occ, sq)
+		ai.byPiece[c][ROOK] |= attacks
+		attacks &= available
 		kingThreats += popCount(attacks & enemyKingZone)
-		// only reward rook mobility in the late-game.
-		mobility += weightScore(phase, 0, rookMobility[popCount(attacks)])
+		mobility += rookMobility[popCount(attacks)]
+		placement += trappedRook(brd, c, sq, kingSq, popCount(attacks))
 	}
 
 	for b = brd.pieces[c][QUEEN]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
-		attacks = queenAttacks(occ, sq) & available
+		attacks = queenAttacks(occ, sq)
+		ai.byPiece[c][QUEEN] |= attacks
+		attacks &= available
 		kingThreats += popCount(attacks & enemyKingZone)
 		mobility += queenMobility[popCount(attacks)]
-		placement += weightScore(phase, 0, // encourage queen to move toward enemy king in the late-game.
-			queenTropismBonus[chebyshevDistance(sq, enemyKingSq)])
+		placement += queenTropismBonus[chebyshevDistance(sq, enemyKingSq)]
 	}
 
-	placement += weightScore(phase,
-		pawnShieldBonus[popCount(brd.pieces[c][PAWN]&kingShieldMasks[c][kingSq])], 0)
+	for pc := PAWN; pc <= KING; pc++ {
+		ai.all[c] |= ai.byPiece[c][pc]
+	}
+
+	placement += pawnShieldBonus[popCount(brd.pieces[c][PAWN]&kingShieldMasks[c][kingSq])]
 
-	placement += weightScore(phase,
-		kingPst[c][MIDGAME][kingSq], kingPst[c][ENDGAME][kingSq])
+	placement += kingPst[c][kingSq]
 
-	placement += weightScore(phase,
-		kingThreatBonus[kingThreats+kingSafteyBase[e][enemyKingSq]], 0)
+	placement += kingThreatBonus[kingThreats+kingSafteyBase[e][enemyKingSq]]
 
 	return placement + mobility
 }
@@ -278,14 +362,18 @@ func setupEval() {
 			mainPst[WHITE][piece][sq] = mainPst[BLACK][piece][squareMirror[sq]]
 		}
 	}
-	for endgame := 0; endgame < 2; endgame++ { // King PST
-		for sq := 0; sq < 64; sq++ {
-			kingPst[WHITE][endgame][sq] = kingPst[BLACK][endgame][squareMirror[sq]]
-		}
+	for sq := 0; sq < 64; sq++ { // King PST
+		kingPst[WHITE][sq] = kingPst[BLACK][squareMirror[sq]]
 	}
 	for sq := 0; sq < 64; sq++ { // King saftey counters
 		kingSafteyBase[WHITE][sq] = kingSafteyBase[BLACK][squareMirror[sq]]
 	}
+	for r := 0; r < 8; r++ { // Pawn structure bonuses by row
+		passedPawnBonus[WHITE][r] = passedPawnBonus[BLACK][7-r]
+		tarraschBonus[WHITE][r] = tarraschBonus[BLACK][7-r]
+		defenseBonus[WHITE][r] = defenseBonus[BLACK][7-r]
+		duoBonus[WHITE][r] = duoBonus[BLACK][7-r]
+	}
 	for i := 0; i <= 24; i++ { // Endgame phase scaling factor
 		endgamePhase[i] = (((MAX_ENDGAME_COUNT - i) * 256) + (MAX_ENDGAME_COUNT / 2)) / MAX_ENDGAME_COUNT
 	}
@@ -0,0 +1,150 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+// MATERIAL EVALUATION
+// Terms that depend only on the number of pieces of each type are evaluated once per material
+// configuration and cached in the material hash table:
+//   -Piece-pawn adjustments - Knights gain value and rooks lose value as pawns are added.
+//   -Bishop pair - Bonus for having both bishops, adjusted by the number of enemy pawns.
+//   -Imbalance - Quadratic interactions between piece types, such as the redundancy of major pieces.
+//   -Game phase - Used to blend midgame and endgame scores.
+//   -Scaling - Reduces the endgame score when the side ahead is unlikely to be able to win.
+//   -Endgame evaluators - Replace the normal evaluation in known endgames.
+
+const (
+	SCALE_DRAW    = 0
+	SCALE_NORMAL  = 64
+	KXK_WIN_BONUS = 1000
+)
+
+var knightPawns = [16]Score{S(-20, -20), S(-16, -16), S(-12, -12), S(-8, -8), S(-4, -4), S(0, 0),
+	S(4, 4), S(8, 8), S(12, 12)}
+var rookPawns = [16]Score{S(16, 16), S(12, 12), S(8, 8), S(4, 4), S(2, 2), S(0, 0), S(-2, -2),
+	S(-4, -4), S(-8, -8)}
+
+var bishopPairBonus = S(40, 40)
+
+// adjusts the value of bishop pairs based on number of enemy pawns in play.
+var bishopPairPawns = [16]Score{S(10, 10), S(10, 10), S(9, 9), S(8, 8), S(6, 6), S(4, 4), S(2, 2),
+	S(0, 0), S(-2, -2)}
+
+// Quadratic imbalance terms, in centipawns per pair of pieces. Rows and columns are indexed by
+// imbalance index: 0 for the bishop pair, and piece type + 1 for the remaining pieces.
+var imbalanceOurs = [6][6]int{
+	// pair  P   N   B    R    Q
+	{0},                 // bishop pair
+	{0, 0},              // pawn
+	{0, 0, -4},          // knight
+	{0, 0, 2, 0},        // bishop
+	{0, 0, -2, -2, -12}, // rook
+	{0, 0, 0, 2, -8, 0}, // queen
+}
+var imbalanceTheirs = [6][6]int{
+	// pair  P   N   B    R    Q
+	{0},                 // bishop pair
+	{0, 0},              // pawn
+	{0, 0, 0},           // knight
+	{0, 0, 2, 0},        // bishop
+	{0, 0, -2, 2, 0},    // rook
+	{0, 0, 4, 6, -4, 0}, // queen
+}
+
+func setMaterialEntry(brd *Board, mentry *MaterialEntry) {
+	var counts [2][6]int
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		for pc := PAWN; pc < KING; pc++ {
+			counts[c][pc+1] = popCount(brd.pieces[c][pc])
+		}
+		if counts[c][BISHOP+1] > 1 {
+			counts[c][0] = 1
+		}
+	}
+	mentry.key = brd.materialKey
+	mentry.phase = endgamePhase[brd.endgameCounter]
+	mentry.value[WHITE] = materialImbalance(&counts, WHITE, BLACK) -
+		materialImbalance(&counts, BLACK, WHITE)
+	mentry.value[BLACK] = -mentry.value[WHITE]
+
+	mentry.evaluator = nil
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		mentry.scale[c] = materialScale(&counts, c, c^1)
+		if isKXK(&counts, c, c^1) {
+			mentry.evaluator, mentry.strong = evalKXK, c
+		}
+	}
+}
+
+func materialImbalance(counts *[2][6]int, c, e uint8) Score {
+	ours, theirs := &counts[c], &counts[e]
+	value := knightPawns[ours[PAWN+1]]*Score(ours[KNIGHT+1]) +
+		rookPawns[ours[PAWN+1]]*Score(ours[ROOK+1])
+	if ours[0] > 0 {
+		value += bishopPairBonus + bishopPairPawns[theirs[PAWN+1]]
+	}
+	var imbalance int
+	for i := 0; i < 6; i++ {
+		if ours[i] == 0 {
+			continue
+		}
+		var v int
+		for j := 0; j <= i; j++ {
+			v += imbalanceOurs[i][j]*ours[j] + imbalanceTheirs[i][j]*theirs[j]
+		}
+		imbalance += v * ours[i]
+	}
+	return value + S(imbalance, imbalance)
+}
+
+func nonPawnMaterial(counts *[2][6]int, c uint8) int {
+	var value int
+	for pc := KNIGHT; pc < KING; pc++ {
+		value += counts[c][pc+1] * pieceValues[pc]
+	}
+	return value
+}
+
+// materialScale returns the scale factor to apply to the endgame score when side c is ahead.
+// Without pawns, a side needs more than a minor piece's advantage to have real winning chances.
+func materialScale(counts *[2][6]int, c, e uint8) uint8 {
+	if counts[c][PAWN+1] > 0 {
+		return SCALE_NORMAL
+	}
+	ours, theirs := nonPawnMaterial(counts, c), nonPawnMaterial(counts, e)
+	if ours < ROOK_VALUE { // a lone minor piece can't force mate.
+		return SCALE_DRAW
+	}
+	if theirs == 0 && ours == 2*KNIGHT_VALUE && counts[c][KNIGHT+1] == 2 {
+		return SCALE_DRAW // two knights can't force mate against a bare king.
+	}
+	if ours-theirs <= BISHOP_VALUE {
+		return SCALE_NORMAL / 4
+	}
+	return SCALE_NORMAL
+}
+
+// ENDGAME EVALUATORS
+
+// KXK: the weak side has a bare king, and the strong side has at least a rook.
+func isKXK(counts *[2][6]int, c, e uint8) bool {
+	for i := 0; i < 6; i++ {
+		if counts[e][i] > 0 {
+			return false
+		}
+	}
+	return counts[c][ROOK+1] > 0 || counts[c][QUEEN+1] > 0
+}
+
+// evalKXK drives the weak king toward the edge of the board and brings the strong king closer.
+func evalKXK(brd *Board, strong uint8) int {
+	weak := strong ^ 1
+	kingSq, weakKingSq := brd.KingSq(strong), brd.KingSq(weak)
+	r, col := row(weakKingSq), column(weakKingSq)
+	edgeDistance := min(r, 7-r) + min(col, 7-col)
+	score := brd.material[strong].EG() + KXK_WIN_BONUS + (6-edgeDistance)*20 +
+		(7-chebyshevDistance(kingSq, weakKingSq))*10
+	return min(score, MIN_MATE-1)
+}
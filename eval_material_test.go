@@ -0,0 +1,102 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"testing"
+)
+
+// The material key is updated incrementally as moves are made and unmade, including captures,
+// promotions, castling and en passant. It must always match the key of the same position parsed
+// from scratch.
+func TestMaterialKeyConsistency(t *testing.T) {
+	positions := []string{
+		"r3k2r/1P6/8/8/8/8/6p1/R3K2R w KQkq - 0 1",
+		"r3k2r/1P6/8/8/8/8/6p1/R3K2R b KQkq - 0 1",
+		"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	}
+	for _, fen := range positions {
+		checkMaterialKey(t, ParseFENString(fen), 2)
+	}
+}
+
+func checkMaterialKey(t *testing.T, brd *Board, depth int) {
+	key := brd.materialKey
+	for _, m := range brd.LegalMoves() {
+		memento := brd.NewMemento()
+		makeMove(brd, m)
+		if expected := ParseFENString(brd.ToFEN()).materialKey; brd.materialKey != expected {
+			t.Errorf("%s after %s: expected material key %x, got %x", brd.ToFEN(), m.ToUCI(), expected,
+				brd.materialKey)
+		}
+		if depth > 1 {
+			checkMaterialKey(t, brd, depth-1)
+		}
+		unmakeMove(brd, m, memento)
+		if brd.materialKey != key {
+			t.Errorf("%s: material key not restored after unmaking %s", brd.ToFEN(), m.ToUCI())
+		}
+	}
+}
+
+func TestMaterialScale(t *testing.T) {
+	tests := []struct {
+		name, fen string
+		expected  uint8
+	}{
+		{"KBK", "8/8/4k3/8/8/3BK3/8/8 w - - 0 1", SCALE_DRAW},
+		{"KNNK", "8/8/4k3/8/8/3NK1N1/8/8 w - - 0 1", SCALE_DRAW},
+		{"KRKB", "8/8/4kb2/8/8/3RK3/8/8 w - - 0 1", SCALE_NORMAL / 4},
+		{"KRKN", "8/8/4kn2/8/8/3RK3/8/8 w - - 0 1", SCALE_NORMAL / 4},
+		{"KQKR", "8/8/4kr2/8/8/3QK3/8/8 w - - 0 1", SCALE_NORMAL},
+		{"KBPK", "8/8/4k3/8/8/3BK3/6P1/8 w - - 0 1", SCALE_NORMAL},
+	}
+	for _, test := range tests {
+		var mentry MaterialEntry
+		setMaterialEntry(ParseFENString(test.fen), &mentry)
+		if mentry.scale[WHITE] != test.expected {
+			t.Errorf("%s: expected scale %d, got %d", test.name, test.expected, mentry.scale[WHITE])
+		}
+	}
+}
+
+func TestKXK(t *testing.T) {
+	tests := []struct {
+		fen       string
+		evaluator bool
+		strong    uint8
+	}{
+		{"8/8/8/4k3/8/8/8/R3K3 w - - 0 1", true, WHITE},
+		{"8/8/8/4k3/8/8/8/q3K3 w - - 0 1", true, BLACK},
+		{"8/8/8/4k3/8/8/8/B3K3 w - - 0 1", false, WHITE}, // a lone minor piece can't force mate.
+		{"8/8/8/4k3/8/8/7p/R3K3 w - - 0 1", false, WHITE},
+	}
+	for _, test := range tests {
+		var mentry MaterialEntry
+		setMaterialEntry(ParseFENString(test.fen), &mentry)
+		if (mentry.evaluator != nil) != test.evaluator || (test.evaluator && mentry.strong != test.strong) {
+			t.Errorf("%s: expected KXK evaluator=%t for side %d", test.fen, test.evaluator, test.strong)
+		}
+	}
+
+	// the weak king is worth more to the strong side the closer it is to a corner, and the score is
+	// given from the point of view of the side to move.
+	worker := NewWorker(0)
+	evaluateFEN := func(fen string) int {
+		brd := ParseFENString(fen)
+		brd.worker = worker
+		return evaluate(brd, -INF, INF)
+	}
+	center, corner := evaluateFEN("8/8/8/4k3/8/8/8/R3K3 w - - 0 1"), evaluateFEN("k7/8/8/8/8/8/8/R3K3 w - - 0 1")
+	if center < KXK_WIN_BONUS || corner <= center {
+		t.Errorf("expected a winning score that grows toward the corner, got %d (center) and %d (corner)",
+			center, corner)
+	}
+	if black := evaluateFEN("8/8/8/4k3/8/8/8/R3K3 b - - 0 1"); black != -center {
+		t.Errorf("expected %d with black to move, got %d", -center, black)
+	}
+}
@@ -7,27 +7,28 @@ package main
 
 // "fmt"
 
-const (
-	DOUBLED_PENALTY  = 20
-	ISOLATED_PENALTY = 12
-	BACKWARD_PENALTY = 4
+var (
+	doubledPenalty  = S(20, 20)
+	isolatedPenalty = S(12, 12)
+	backwardPenalty = S(4, 4)
+	spaceBonus      = S(2, 0)
 )
 
-var passedPawnBonus = [2][8]int{
-	{0, 192, 96, 48, 24, 12, 6, 0},
-	{0, 6, 12, 24, 48, 96, 192, 0},
+var passedPawnBonus = [2][8]Score{
+	{S(0, 0), S(192, 192), S(96, 96), S(48, 48), S(24, 24), S(12, 12), S(6, 6), S(0, 0)},
+	{S(0, 0), S(6, 6), S(12, 12), S(24, 24), S(48, 48), S(96, 96), S(192, 192), S(0, 0)},
 }
-var tarraschBonus = [2][8]int{
-	{0, 12, 8, 4, 2, 0, 0, 0},
-	{0, 0, 0, 2, 4, 8, 12, 0},
+var tarraschBonus = [2][8]Score{
+	{S(0, 0), S(12, 12), S(8, 8), S(4, 4), S(2, 2), S(0, 0), S(0, 0), S(0, 0)},
+	{S(0, 0), S(0, 0), S(0, 0), S(2, 2), S(4, 4), S(8, 8), S(12, 12), S(0, 0)},
 }
-var defenseBonus = [2][8]int{
-	{0, 12, 8, 6, 5, 4, 3, 0},
-	{0, 3, 4, 5, 6, 8, 12, 0},
+var defenseBonus = [2][8]Score{
+	{S(0, 0), S(12, 12), S(8, 8), S(6, 6), S(5, 5), S(4, 4), S(3, 3), S(0, 0)},
+	{S(0, 0), S(3, 3), S(4, 4), S(5, 5), S(6, 6), S(8, 8), S(12, 12), S(0, 0)},
 }
-var duoBonus = [2][8]int{
-	{0, 0, 2, 1, 1, 1, 0, 0},
-	{0, 0, 1, 1, 1, 2, 0, 0},
+var duoBonus = [2][8]Score{
+	{S(0, 0), S(0, 0), S(2, 2), S(1, 1), S(1, 1), S(1, 1), S(0, 0), S(0, 0)},
+	{S(0, 0), S(0, 0), S(1, 1), S(1, 1), S(1, 1), S(2, 2), S(0, 0), S(0, 0)},
 }
 
 // var promoteRow = [2][2]int{
@@ -44,11 +45,16 @@ var duoBonus = [2][8]int{
 //   -Isolated pawns - Penalty for any pawn without friendly pawns on adjacent files.
 //   -Double/tripled pawns - Penalty for having multiple pawns on the same file.
 //   -Backward pawns
+// Space:
+//   -Safe squares in the center of the board behind the pawn chain.
 
 func setPawnStructure(brd *Board, pentry *PawnEntry) {
 	pentry.key = brd.pawnHashKey
 	setPawnMaps(brd, pentry, WHITE)
 	setPawnMaps(brd, pentry, BLACK)
+	setPawnFiles(brd, pentry, WHITE, BLACK)
+	setPawnFiles(brd, pentry, BLACK, WHITE)
+	pentry.openFiles = pentry.semiOpen[WHITE] & pentry.semiOpen[BLACK]
 	pentry.value[WHITE] = pawnStructure(brd, pentry, WHITE, BLACK) -
 		pawnStructure(brd, pentry, BLACK, WHITE)
 	pentry.value[BLACK] = -pentry.value[WHITE]
@@ -61,10 +67,30 @@ func setPawnMaps(brd *Board, pentry *PawnEntry, c uint8) {
 	pentry.passedPawns[c] = 0
 }
 
-// pawn_structure() sets the remaining pentry attributes for side c
-func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) int {
+// setPawnFiles sets the semi-open file and outpost masks for side c. Both depend on the pawn
+// attack maps, so this must be called after setPawnMaps() has been called for each side.
+func setPawnFiles(brd *Board, pentry *PawnEntry, c, e uint8) {
+	ownPawns, enemyPawns := brd.pieces[c][PAWN], brd.pieces[e][PAWN]
+	pentry.semiOpen[c] = 0
+	for col := 0; col < 8; col++ {
+		if columnMasks[col]&ownPawns == 0 {
+			pentry.semiOpen[c] |= columnMasks[col]
+		}
+	}
+	var sq int
+	pentry.outposts[c] = 0
+	for b := outpostMasks[c] & pentry.allAttacks[c]; b > 0; b.Clear(sq) {
+		sq = lsb(b)
+		if pawnAttackSpans[c][sq]&enemyPawns == 0 {
+			pentry.outposts[c].Add(sq)
+		}
+	}
+}
 
-	var value, sq, sqRow int
+// pawn_structure() sets the remaining pentry attributes for side c
+func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) Score {
+	var value Score
+	var sq, sqRow int
 	ownPawns, enemyPawns := brd.pieces[c][PAWN], brd.pieces[e][PAWN]
 	for b := ownPawns; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
@@ -78,7 +104,7 @@ func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) int {
 		}
 
 		if pawnDoubledMasks[sq]&ownPawns > 0 { // doubled or tripled pawns
-			value -= DOUBLED_PENALTY
+			value -= doubledPenalty
 		}
 
 		if pawnPassedMasks[c][sq]&enemyPawns == 0 { // passed pawns
@@ -86,7 +112,7 @@ func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) int {
 			pentry.passedPawns[c].Add(sq) // note the passed pawn location in the pawn hash entry.
 		} else { // don't penalize passed pawns for being isolated.
 			if pawnIsolatedMasks[sq]&ownPawns == 0 {
-				value -= ISOLATED_PENALTY // isolated pawns
+				value -= isolatedPenalty // isolated pawns
 			}
 		}
 
@@ -97,41 +123,128 @@ func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) int {
 		// 3. their stop square is not defended by a friendly pawn
 		if (pawnBackwardSpans[c][sq]&ownPawns == 0) &&
 			(pentry.allAttacks[e]&pawnStopMasks[c][sq] > 0) {
-			value -= BACKWARD_PENALTY
+			value -= backwardPenalty
 		}
 	}
+	value += spaceBonus * Score(spaceCount(brd, pentry, c, e))
 	return value
 }
 
-func netPawnPlacement(brd *Board, pentry *PawnEntry, c, e uint8) int {
-	return pentry.value[c] + netPassedPawns(brd, pentry, c, e)
+// spaceCount gives the number of central squares behind side c's pawns that are not attacked by
+// enemy pawns. Pieces can be developed safely on these squares.
+func spaceCount(brd *Board, pentry *PawnEntry, c, e uint8) int {
+	var behind BB
+	var sq int
+	ownPawns := brd.pieces[c][PAWN]
+	for b := ownPawns; b > 0; b.Clear(sq) {
+		sq = lsb(b)
+		behind |= pawnFrontSpans[e][sq]
+	}
+	return popCount(spaceMasks[c] & behind & (^ownPawns) & (^pentry.allAttacks[e]))
+}
+
+func netPawnPlacement(brd *Board, pentry *PawnEntry, ai *AttackInfo, c, e uint8) Score {
+	return pentry.value[c] + netPassedPawns(brd, pentry, ai, c, e)
+}
+
+func netPassedPawns(brd *Board, pentry *PawnEntry, ai *AttackInfo, c, e uint8) Score {
+	return evalPassedPawns(brd, ai, c, e, pentry.passedPawns[c]) -
+		evalPassedPawns(brd, ai, e, c, pentry.passedPawns[e])
 }
 
-func netPassedPawns(brd *Board, pentry *PawnEntry, c, e uint8) int {
-	return evalPassedPawns(brd, c, e, pentry.passedPawns[c]) -
-		evalPassedPawns(brd, e, c, pentry.passedPawns[e])
+// PASSED PAWNS
+// In addition to the static bonus by rank given in pawnStructure(), each passed pawn is scored
+// based on its surroundings. Most of these terms are scaled by passedRankWeight, so that they
+// matter more as the pawn nears its promotion square:
+//   -King proximity - Bonus for keeping the enemy king away from the pawn's stop square, and for
+//                     bringing the friendly king close to it.
+//   -Free path - Bonus if no pieces stand between the pawn and its promotion square, and a further
+//                bonus if the enemy does not attack any of those squares.
+//   -Blockade - Penalty if an enemy piece occupies the stop square.
+//   -Supported and connected passers - Bonus for passers defended by or beside a friendly pawn.
+//   -Tarrasch rule - Bonus for a friendly rook behind the passer, penalty for an enemy rook.
+//   -Unstoppable passers - In pawn endings, a pawn the enemy king cannot catch (the rule of the
+//                          square) is nearly as good as a new queen.
+
+var passedRankWeight = [8]int{0, 0, 0, 1, 3, 5, 8, 0} // by rank from the pawn's point of view.
+
+var (
+	passedEnemyKingBonus   = S(0, 5)
+	passedOwnKingPenalty   = S(0, -2)
+	passedFreePathBonus    = S(4, 8)
+	passedSafePathBonus    = S(2, 6)
+	passedBlockadePenalty  = S(-4, -10)
+	passedSupportedBonus   = S(3, 6)
+	passedConnectedBonus   = S(2, 6)
+	unstoppablePasserBonus = S(0, 600)
+)
+
+func relativeRow(c uint8, sq int) int {
+	if c == WHITE {
+		return row(sq)
+	}
+	return 7 - row(sq)
 }
 
-func evalPassedPawns(brd *Board, c, e uint8, passedPawns BB) int {
-	var value, sq int
-	enemyKingSq := brd.KingSq(e)
+func evalPassedPawns(brd *Board, ai *AttackInfo, c, e uint8, passedPawns BB) Score {
+	var value, weighted Score
+	var sq, weight int
+	kingSq, enemyKingSq := brd.KingSq(c), brd.KingSq(e)
+	occ := brd.AllOccupied()
+	ownPawns := brd.pieces[c][PAWN]
+	pawnEnding := brd.ColorPawnsOnly(e)
 	for ; passedPawns > 0; passedPawns.Clear(sq) {
 		sq = furthestForward(c, passedPawns)
-		// Tarrasch rule: assign small bonus for friendly rook behind the passed pawn
-		if pawnFrontSpans[e][sq]&brd.pieces[c][ROOK] > 0 {
+		weight = passedRankWeight[relativeRow(c, sq)]
+		stopSq := pawnStopSq[c][sq]
+		path := pawnFrontSpans[c][sq]
+
+		// Tarrasch rule: a rook is most effective behind a passed pawn, whether supporting its
+		// advance or attacking it from behind.
+		behind := rookAttacks(occ, sq) & pawnFrontSpans[e][sq]
+		if behind&brd.pieces[c][ROOK] > 0 {
 			value += tarraschBonus[c][row(sq)]
+		} else if behind&brd.pieces[e][ROOK] > 0 {
+			value -= tarraschBonus[c][row(sq)]
 		}
-		// pawn race: Assign a bonus if the pawn is closer to its promote square than the enemy king.
-		promoteSquare := pawnPromoteSq[c][sq]
-		if brd.c == c {
-			if chebyshevDistance(sq, promoteSquare) < (chebyshevDistance(enemyKingSq, promoteSquare)) {
-				value += passedPawnBonus[c][row(sq)]
-			}
-		} else {
-			if chebyshevDistance(sq, promoteSquare) < (chebyshevDistance(enemyKingSq, promoteSquare) - 1) {
-				value += passedPawnBonus[c][row(sq)]
+
+		weighted = passedEnemyKingBonus * Score(min(chebyshevDistance(enemyKingSq, stopSq), 5))
+		weighted += passedOwnKingPenalty * Score(min(chebyshevDistance(kingSq, stopSq), 5))
+
+		if path&occ == 0 {
+			weighted += passedFreePathBonus
+			if path&ai.all[e] == 0 {
+				weighted += passedSafePathBonus
 			}
+		} else if brd.Placement(e)&sqMaskOn[stopSq] > 0 {
+			weighted += passedBlockadePenalty
+		}
+
+		if pawnAttackMasks[e][sq]&ownPawns > 0 {
+			weighted += passedSupportedBonus
+		} else if pawnSideMasks[sq]&ownPawns > 0 {
+			weighted += passedConnectedBonus
+		}
+		value += weighted * Score(weight)
+
+		// rule of the square: in pawn endings, the pawn will promote if the enemy king can't catch it
+		// and friendly pieces don't block its path.
+		if pawnEnding && path&brd.Placement(c) == 0 && isUnstoppable(brd, c, e, sq) {
+			value += unstoppablePasserBonus
 		}
 	}
 	return value
 }
+
+func isUnstoppable(brd *Board, c, e uint8, sq int) bool {
+	promoteSq := pawnPromoteSq[c][sq]
+	pawnDistance := chebyshevDistance(sq, promoteSq)
+	if relativeRow(c, sq) == 1 { // pawns on their starting square may advance two squares.
+		pawnDistance--
+	}
+	kingDistance := chebyshevDistance(brd.KingSq(e), promoteSq)
+	if brd.c == e { // the enemy king gets the first move.
+		kingDistance--
+	}
+	return pawnDistance < kingDistance
+}
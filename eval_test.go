@@ -0,0 +1,183 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"testing"
+)
+
+// evalMaps fills in the pawn entry and attack maps for both sides, as evaluate() would.
+func evalMaps(brd *Board) (*PawnEntry, *AttackInfo) {
+	pentry, ai := new(PawnEntry), new(AttackInfo)
+	setPawnStructure(brd, pentry)
+	kingSq, enemyKingSq := brd.KingSq(WHITE), brd.KingSq(BLACK)
+	majorPlacement(brd, pentry, ai, WHITE, BLACK, kingSq, enemyKingSq)
+	majorPlacement(brd, pentry, ai, BLACK, WHITE, enemyKingSq, kingSq)
+	return pentry, ai
+}
+
+func TestThreats(t *testing.T) {
+	tests := []struct {
+		name, fen string
+		expected  Score
+	}{
+		{"pawn threat", "4k3/8/2p5/3n4/4P3/8/8/4K3 w - - 0 1", pawnThreatBonus},
+		{"minor threat", "4k3/8/8/1p6/2r5/8/3N4/4K3 w - - 0 1", minorThreatBonus[ROOK]},
+		{"rook threat", "4k3/3q4/8/8/8/8/8/3RK3 w - - 0 1", rookThreatBonus[QUEEN]},
+		{"hanging piece", "4k3/8/8/8/8/8/4p3/4K3 w - - 0 1", hangingBonus},
+		{"no threats", "4k3/8/8/8/8/8/8/4K3 w - - 0 1", 0},
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		_, ai := evalMaps(brd)
+		if value := threats(brd, ai, WHITE, BLACK); value != test.expected {
+			t.Errorf("%s: expected (%d, %d), got (%d, %d)", test.name, test.expected.MG(),
+				test.expected.EG(), value.MG(), value.EG())
+		}
+	}
+}
+
+func TestTrappedPieces(t *testing.T) {
+	rookTests := []struct {
+		fen      string
+		sq       int
+		expected Score
+	}{
+		{"4k3/8/8/8/8/8/6PP/5K1R w - - 0 1", H1, trappedRookPenalty},
+		{"4k3/8/8/8/8/8/6PP/4K2R w K - 0 1", H1, 0}, // the king can still castle.
+		{"4k3/8/8/8/8/8/PP6/R1K5 w - - 0 1", A1, trappedRookPenalty},
+		{"4k3/8/8/8/8/8/P7/RN3K2 w - - 0 1", A1, 0}, // the king is not between rook and corner.
+	}
+	for _, test := range rookTests {
+		brd := ParseFENString(test.fen)
+		mobility := popCount(rookAttacks(brd.AllOccupied(), test.sq) & (^brd.Placement(WHITE)))
+		if value := trappedRook(brd, WHITE, test.sq, brd.KingSq(WHITE), mobility); value != test.expected {
+			t.Errorf("%s: expected trapped rook penalty %d, got %d", test.fen, test.expected.MG(), value.MG())
+		}
+	}
+	bishopTests := []struct {
+		fen      string
+		sq       int
+		expected Score
+	}{
+		{"4k3/B7/1p6/8/8/8/8/4K3 w - - 0 1", A7, trappedBishopPenalty},
+		{"4k3/B7/8/1p6/8/8/8/4K3 w - - 0 1", A7, 0},
+		{"4k3/7B/6p1/8/8/8/8/4K3 w - - 0 1", H7, trappedBishopPenalty},
+	}
+	for _, test := range bishopTests {
+		brd := ParseFENString(test.fen)
+		if value := trappedBishop(brd, WHITE, BLACK, test.sq); value != test.expected {
+			t.Errorf("%s: expected trapped bishop penalty %d, got %d", test.fen, test.expected.MG(), value.MG())
+		}
+	}
+}
+
+func TestOutposts(t *testing.T) {
+	tests := []struct {
+		fen     string
+		sq      int
+		outpost bool
+	}{
+		{"4k3/8/8/3N4/4P3/8/8/4K3 w - - 0 1", D5, true},
+		{"4k3/2p5/8/3N4/4P3/8/8/4K3 w - - 0 1", D5, false}, // c7 pawn can drive the knight away.
+		{"4k3/8/8/3N4/8/8/8/4K3 w - - 0 1", D5, false},     // not supported by a pawn.
+		{"4k3/8/8/8/8/3N4/4P3/4K3 w - - 0 1", D3, false},   // not advanced far enough.
+	}
+	for _, test := range tests {
+		pentry, _ := evalMaps(ParseFENString(test.fen))
+		if outpost := pentry.outposts[WHITE]&sqMaskOn[test.sq] > 0; outpost != test.outpost {
+			t.Errorf("%s: expected outpost=%t, got %t", test.fen, test.outpost, outpost)
+		}
+	}
+}
+
+func TestSemiOpenFiles(t *testing.T) {
+	pentry, _ := evalMaps(ParseFENString("4k3/4p3/8/8/8/8/3P4/4K3 w - - 0 1"))
+	tests := []struct {
+		name     string
+		mask     BB
+		col      int
+		expected bool
+	}{
+		{"white semi-open d-file", pentry.semiOpen[WHITE], 3, false},
+		{"white semi-open e-file", pentry.semiOpen[WHITE], 4, true},
+		{"black semi-open d-file", pentry.semiOpen[BLACK], 3, true},
+		{"black semi-open e-file", pentry.semiOpen[BLACK], 4, false},
+		{"open d-file", pentry.openFiles, 3, false},
+		{"open e-file", pentry.openFiles, 4, false},
+		{"open a-file", pentry.openFiles, 0, true},
+	}
+	for _, test := range tests {
+		if found := test.mask&columnMasks[test.col] == columnMasks[test.col]; found != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, found)
+		}
+	}
+}
+
+func TestSpace(t *testing.T) {
+	tests := []struct {
+		fen      string
+		c        uint8
+		expected int
+	}{
+		{"4k3/8/8/8/2PPPP2/8/8/4K3 w - - 0 1", WHITE, 8},
+		{"4k3/8/8/8/1pPPPP2/8/8/4K3 w - - 0 1", WHITE, 7}, // c3 is attacked by the b4 pawn.
+		{"4k3/8/8/8/8/8/2PPPP2/4K3 w - - 0 1", WHITE, 0},  // no central squares behind the pawns.
+		{"4k3/8/8/2pppp2/8/8/8/4K3 w - - 0 1", BLACK, 8},
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		pentry, _ := evalMaps(brd)
+		if count := spaceCount(brd, pentry, test.c, test.c^1); count != test.expected {
+			t.Errorf("%s: expected %d safe squares, got %d", test.fen, test.expected, count)
+		}
+	}
+}
+
+// The rule of the square: a passed pawn promotes if the enemy king can't reach its promotion square
+// in time, counting the king's first move when it is the enemy's turn.
+func TestUnstoppablePassers(t *testing.T) {
+	tests := []struct {
+		fen         string
+		sq          int
+		unstoppable bool
+	}{
+		{"8/8/8/P3k3/8/8/8/K7 w - - 0 1", A5, true},  // outside the square.
+		{"8/8/8/P3k3/8/8/8/K7 b - - 0 1", A5, false}, // the king steps into the square.
+		{"8/8/8/P4k2/8/8/8/K7 b - - 0 1", A5, true},
+		{"8/8/8/P1k5/8/8/8/K7 w - - 0 1", A5, false}, // inside the square.
+		{"8/8/8/8/6k1/8/P7/K7 w - - 0 1", A2, true},  // the pawn may advance two squares.
+		{"8/8/8/8/5k2/8/P7/K7 w - - 0 1", A2, false},
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		if unstoppable := isUnstoppable(brd, WHITE, BLACK, test.sq); unstoppable != test.unstoppable {
+			t.Errorf("%s: expected unstoppable=%t, got %t", test.fen, test.unstoppable, unstoppable)
+		}
+	}
+}
+
+// A passed pawn outside the square only gets the unstoppable bonus if its own pieces don't stand in
+// its way.
+func TestUnstoppablePasserBlocked(t *testing.T) {
+	tests := []struct {
+		fen   string
+		bonus bool
+	}{
+		{"8/8/8/P6k/8/8/8/K7 w - - 0 1", true},
+		{"K7/8/8/P6k/8/8/8/8 w - - 0 1", false},  // the king blocks the pawn's path.
+		{"8/8/8/P6k/8/8/7q/K7 w - - 0 1", false}, // not a pawn ending.
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		pentry, ai := evalMaps(brd)
+		value := evalPassedPawns(brd, ai, WHITE, BLACK, pentry.passedPawns[WHITE])
+		if bonus := value.EG() > unstoppablePasserBonus.EG()/2; bonus != test.bonus {
+			t.Errorf("%s: expected unstoppable bonus=%t, got endgame score %d", test.fen, test.bonus,
+				value.EG())
+		}
+	}
+}
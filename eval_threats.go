@@ -0,0 +1,86 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+// AttackInfo records the squares attacked by each piece type for both sides. It is filled in by
+// majorPlacement() and used to evaluate threats once the attack maps for both sides are complete.
+type AttackInfo struct {
+	byPiece [2][8]BB
+	all     [2]BB
+}
+
+// THREATS
+//   -Pawn threats - Bonus for attacking an enemy piece with a pawn.
+//   -Minor threats - Bonus for attacking enemy pieces with a knight or bishop.
+//   -Rook threats - Bonus for attacking enemy pieces with a rook.
+//   -Hanging pieces - Bonus for attacking an enemy piece that is not defended.
+// TRAPPED PIECES
+//   -Rooks hemmed in by their own uncastled king.
+//   -Bishops trapped on the rim by an enemy pawn, i.e. Bxa7 b6.
+
+var pawnThreatBonus = S(48, 32)
+
+// bonus by type of piece attacked.
+var minorThreatBonus = [8]Score{S(4, 12), S(20, 20), S(20, 20), S(36, 24), S(40, 40)}
+var rookThreatBonus = [8]Score{S(2, 12), S(16, 20), S(16, 20), S(0, 0), S(32, 32)}
+
+var hangingBonus = S(24, 16)
+
+var (
+	trappedRookPenalty   = S(-40, -10)
+	trappedBishopPenalty = S(-60, -60)
+)
+
+// threats returns the bonus for side c for attacks against enemy pieces.
+func threats(brd *Board, ai *AttackInfo, c, e uint8) Score {
+	var value Score
+	var sq int
+	nonPawns := brd.Placement(e) & (^brd.pieces[e][PAWN]) & (^brd.pieces[e][KING])
+
+	value += pawnThreatBonus * Score(popCount(ai.byPiece[c][PAWN]&nonPawns))
+
+	minorAttacks := ai.byPiece[c][KNIGHT] | ai.byPiece[c][BISHOP]
+	for b := minorAttacks & brd.Placement(e); b > 0; b.Clear(sq) {
+		sq = lsb(b)
+		value += minorThreatBonus[brd.squares[sq]]
+	}
+	for b := ai.byPiece[c][ROOK] & brd.Placement(e); b > 0; b.Clear(sq) {
+		sq = lsb(b)
+		value += rookThreatBonus[brd.squares[sq]]
+	}
+
+	hanging := brd.Placement(e) & (^brd.pieces[e][KING]) & ai.all[c] & (^ai.all[e])
+	value += hangingBonus * Score(popCount(hanging))
+	return value
+}
+
+// A rook is considered trapped when it has little mobility and is stuck between its own king and
+// the corner, with the king no longer able to castle.
+func trappedRook(brd *Board, c uint8, sq, kingSq, mobility int) Score {
+	if mobility > 3 || brd.castle&castleRights[c] > 0 || row(kingSq) != backRow[c] ||
+		row(sq) != backRow[c] {
+		return 0
+	}
+	kingCol, rookCol := column(kingSq), column(sq)
+	if (kingCol > 3 && rookCol > kingCol) || (kingCol < 4 && rookCol < kingCol) {
+		return trappedRookPenalty
+	}
+	return 0
+}
+
+var trappedBishopSquares = [2][2][2]int{ // bishop square and the enemy pawn square trapping it.
+	{{A2, B3}, {H2, G3}},
+	{{A7, B6}, {H7, G6}},
+}
+
+func trappedBishop(brd *Board, c, e uint8, sq int) Score {
+	for _, squares := range trappedBishopSquares[c] {
+		if sq == squares[0] && brd.pieces[e][PAWN]&sqMaskOn[squares[1]] > 0 {
+			return trappedBishopPenalty
+		}
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+// GameState tracks a game in progress, and determines whether the game is over and why.
+// Threefold repetition and the fifty-move rule give the players the right to claim a draw, while
+// fivefold repetition and the seventy-five-move rule end the game automatically. Since engines
+// always claim a draw when entitled to, all of these are treated as ending the game.
+
+type GameStatus int
+
+const (
+	GAME_ONGOING GameStatus = iota
+	GAME_CHECKMATE
+	GAME_STALEMATE
+	GAME_INSUFFICIENT_MATERIAL
+	GAME_FIVEFOLD_REPETITION
+	GAME_SEVENTY_FIVE_MOVE_RULE
+	GAME_THREEFOLD_REPETITION
+	GAME_FIFTY_MOVE_RULE
+)
+
+var gameStatusNames = [8]string{"ongoing", "checkmate", "stalemate", "insufficient material",
+	"fivefold repetition", "seventy-five-move rule", "threefold repetition", "fifty-move rule"}
+
+func (status GameStatus) String() string {
+	return gameStatusNames[status]
+}
+
+type GameState struct {
+	brd     *Board
+	history []uint64 // hash keys of each position reached, including the current position.
+}
+
+func NewGameState(brd *Board) *GameState {
+	return &GameState{brd: brd, history: []uint64{brd.hashKey}}
+}
+
+// MakeMove plays m on the game board. m is assumed to be legal.
+func (gs *GameState) MakeMove(m Move) {
+	makeMove(gs.brd, m)
+	gs.history = append(gs.history, gs.brd.hashKey)
+}
+
+func (gs *GameState) Status() GameStatus {
+	brd := gs.brd
+	// checkmate takes precedence over the draw rules.
+	if len(brd.LegalMoves()) == 0 {
+		if brd.InCheck() {
+			return GAME_CHECKMATE
+		}
+		return GAME_STALEMATE
+	}
+	if insufficientMaterial(brd) {
+		return GAME_INSUFFICIENT_MATERIAL
+	}
+	repetitions := gs.Repetitions()
+	switch {
+	case repetitions >= 5:
+		return GAME_FIVEFOLD_REPETITION
+	case brd.halfmoveClock >= 150:
+		return GAME_SEVENTY_FIVE_MOVE_RULE
+	case repetitions >= 3:
+		return GAME_THREEFOLD_REPETITION
+	case brd.halfmoveClock >= 100:
+		return GAME_FIFTY_MOVE_RULE
+	}
+	return GAME_ONGOING
+}
+
+func (gs *GameState) IsOver() bool {
+	return gs.Status() != GAME_ONGOING
+}
+
+// Repetitions returns the number of times the current position has occurred. Only positions
+// since the last irreversible move need to be considered.
+func (gs *GameState) Repetitions() int {
+	hashKey := gs.brd.hashKey
+	count := 0
+	for i := len(gs.history) - 1; i >= 0 && i >= len(gs.history)-1-int(gs.brd.halfmoveClock); i -= 2 {
+		if gs.history[i] == hashKey {
+			count++
+		}
+	}
+	return count
+}
+
+// Result returns the result of the game in PGN notation.
+func (gs *GameState) Result() string {
+	switch gs.Status() {
+	case GAME_ONGOING:
+		return "*"
+	case GAME_CHECKMATE:
+		if gs.brd.c == WHITE {
+			return "0-1"
+		}
+		return "1-0"
+	default:
+		return "1/2-1/2"
+	}
+}
+
+// insufficientMaterial returns true if neither side can possibly deliver checkmate: each side has
+// at most a lone minor piece between them, or only bishops that all travel on the same color.
+func insufficientMaterial(brd *Board) bool {
+	var knights, bishops BB
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		if brd.pieces[c][PAWN]|brd.pieces[c][ROOK]|brd.pieces[c][QUEEN] > 0 {
+			return false
+		}
+		knights |= brd.pieces[c][KNIGHT]
+		bishops |= brd.pieces[c][BISHOP]
+	}
+	if popCount(knights|bishops) <= 1 {
+		return true
+	}
+	return knights == 0 && (bishops&LIGHT_SQUARES_MASK == 0 || bishops&^LIGHT_SQUARES_MASK == 0)
+}
@@ -0,0 +1,47 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"testing"
+)
+
+func TestGameStatus(t *testing.T) {
+	tests := []struct {
+		fen    string
+		moves  []string
+		status GameStatus
+		result string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []string{"f2f3", "e7e5", "g2g4", "d8h4"},
+			GAME_CHECKMATE, "0-1"},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", nil, GAME_STALEMATE, "1/2-1/2"},
+		{"8/8/4k3/8/8/3BK3/8/8 w - - 0 1", nil, GAME_INSUFFICIENT_MATERIAL, "1/2-1/2"},
+		{"8/8/4k1b1/8/8/3BK3/8/8 w - - 0 1", nil, GAME_INSUFFICIENT_MATERIAL, "1/2-1/2"},
+		{"8/8/4kb2/8/8/3BK3/8/8 w - - 0 1", nil, GAME_ONGOING, "*"},
+		{"8/8/4kn2/8/8/3BK3/8/8 w - - 0 1", nil, GAME_ONGOING, "*"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			[]string{"g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1", "f6g8"},
+			GAME_THREEFOLD_REPETITION, "1/2-1/2"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			[]string{"g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6",
+				"f3g1", "f6g8", "g1f3", "g8f6", "f3g1", "f6g8"},
+			GAME_FIVEFOLD_REPETITION, "1/2-1/2"},
+		{"8/8/4k3/8/8/3RK3/8/8 w - - 99 1", []string{"d3d1"}, GAME_FIFTY_MOVE_RULE, "1/2-1/2"},
+		{"8/8/4k3/8/8/3RK3/8/8 w - - 149 1", []string{"d3d1"}, GAME_SEVENTY_FIVE_MOVE_RULE, "1/2-1/2"},
+		{"7k/8/6K1/8/8/8/8/R7 w - - 149 1", []string{"a1a8"}, GAME_CHECKMATE, "1-0"},
+	}
+	for _, test := range tests {
+		gs := NewGameState(ParseFENString(test.fen))
+		for _, moveStr := range test.moves {
+			gs.MakeMove(ParseMove(gs.brd, moveStr))
+		}
+		if status := gs.Status(); status != test.status || gs.Result() != test.result {
+			t.Errorf("%s %v: expected %s (%s), got %s (%s)", test.fen, test.moves, test.status,
+				test.result, status, gs.Result())
+		}
+	}
+}
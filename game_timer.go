@@ -13,6 +13,8 @@
 package main
 
 import (
+	"math"
+	"sync"
 	"time"
 )
 
@@ -21,39 +23,129 @@ const (
 	MIN_MOVES_REMAINING = 15
 	MAX_TIME            = time.Duration(8) * time.Hour        // default search time limit
 	SAFETY_MARGIN       = time.Duration(5) * time.Millisecond // minimal amount of time to keep on clock
+	MIN_TIME_LIMIT      = time.Millisecond
+	HARD_LIMIT_SCALE    = 5 // the hard limit is at most this multiple of the soft limit.
 )
 
+// Scaling of the soft limit according to the stability of the search.
+const (
+	INSTABILITY_WEIGHT = 0.5 // added per recent change of best move.
+	SCORE_DROP_MAX     = 100 // score drops beyond this many centipawns get no further time.
+	SCORE_DROP_WEIGHT  = 0.5 // added for a score drop of SCORE_DROP_MAX.
+	NODE_SHARE_BASE    = 1.5 // the node share of the best move is subtracted from this.
+	MIN_TIME_SCALE     = 0.25
+	MAX_TIME_SCALE     = 3.0
+)
+
+// The soft limit is the time the search aims to spend on a move. It's checked between iterations
+// of iterative deepening, and is scaled up or down by how settled the search appears to be. The
+// hard limit can't be exceeded: once it's reached, the search is aborted mid-iteration.
+//
+// When pondering, the clock is started on ponderhit, while the search continues. The engine's
+// clock only runs from ponderhit, so the hard limit is measured from then. Time spent pondering
+// still counts toward the soft limit, since the search has already made that much progress.
 type GameTimer struct {
-	inc            [2]time.Duration
-	remaining      [2]time.Duration
-	movesRemaining int
-	startTime      time.Time
-	timer          *time.Timer
-	s              *Search
-	sideToMove     uint8
+	sync.Mutex // the clock may be started by ponderhit while the search is running.
+
+	inc                  [2]time.Duration
+	remaining            [2]time.Duration
+	movesToGo            int // moves until the next time control, or 0 for sudden death.
+	movesPlayed          int
+	moveTime             time.Duration // if set, search for exactly this long.
+	overhead             time.Duration // time lost per move to communication with the GUI.
+	softLimit, hardLimit time.Duration
+	scale                float64   // the latest scale applied to the soft limit, or 0 before any.
+	startTime            time.Time // when the search began.
+	clockStart           time.Time // when the clock was started: on go, or on ponderhit.
+	timer                *time.Timer
+	s                    *Search
+	sideToMove           uint8
 }
 
 func NewGameTimer(movesPlayed int, sideToMove uint8) *GameTimer {
 	return &GameTimer{
-		movesRemaining: max(MIN_MOVES_REMAINING, AVG_MOVES_PER_GAME-movesPlayed),
-		remaining:      [2]time.Duration{MAX_TIME, MAX_TIME},
-		sideToMove:     sideToMove,
-		startTime:      time.Now(),
+		movesPlayed: movesPlayed,
+		remaining:   [2]time.Duration{MAX_TIME, MAX_TIME},
+		overhead:    time.Duration(searchConfig.moveOverhead) * time.Millisecond,
+		sideToMove:  sideToMove,
+		startTime:   time.Now(),
 	}
 }
 
 func (gt *GameTimer) SetMoveTime(timeLimit time.Duration) {
-	gt.remaining = [2]time.Duration{timeLimit, timeLimit}
-	gt.inc = [2]time.Duration{0, 0}
-	gt.movesRemaining = 1
+	gt.moveTime = timeLimit
 }
 
+// Start sets the time limits and starts the clock. If the clock is started by ponderhit and the
+// search has already used up its soft limit while pondering, the search is stopped immediately.
 func (gt *GameTimer) Start() {
-	gt.timer = time.AfterFunc(gt.TimeLimit(), gt.s.Abort)
+	gt.Lock()
+	defer gt.Unlock()
+	gt.clockStart = time.Now()
+	gt.setLimits()
+	gt.timer = time.AfterFunc(gt.hardLimit, gt.s.Abort)
+	if gt.scale > 0 && gt.softLimitReached() {
+		gt.s.Abort()
+	}
 }
 
-func (gt *GameTimer) TimeLimit() time.Duration {
-	return (gt.remaining[gt.sideToMove] - SAFETY_MARGIN) / time.Duration(gt.movesRemaining)
+// setLimits divides the time remaining on the clock between the moves left until the next time
+// control, counting the increment that will be received for each of them. Without movestogo,
+// the number of moves left in the game is estimated from the number already played.
+func (gt *GameTimer) setLimits() {
+	if gt.moveTime > 0 {
+		gt.softLimit, gt.hardLimit = 0, clampDuration(gt.moveTime-gt.overhead, MIN_TIME_LIMIT, MAX_TIME)
+		return
+	}
+	movesToGo := gt.movesToGo
+	if movesToGo == 0 {
+		movesToGo = max(MIN_MOVES_REMAINING, AVG_MOVES_PER_GAME-gt.movesPlayed)
+	}
+	remaining, inc := gt.remaining[gt.sideToMove], gt.inc[gt.sideToMove]
+	maxUsable := clampDuration(remaining-gt.overhead-SAFETY_MARGIN, MIN_TIME_LIMIT, MAX_TIME)
+
+	soft := (remaining+inc*time.Duration(movesToGo-1))/time.Duration(movesToGo) - gt.overhead
+	gt.softLimit = clampDuration(soft, MIN_TIME_LIMIT, maxUsable)
+	// keep at least half of what would be left after the soft limit for the remaining moves.
+	gt.hardLimit = clampDuration(gt.softLimit*HARD_LIMIT_SCALE, gt.softLimit,
+		gt.softLimit+(maxUsable-gt.softLimit)/2)
+}
+
+func clampDuration(d, lower, upper time.Duration) time.Duration {
+	if d < lower {
+		return lower
+	} else if d > upper {
+		return upper
+	}
+	return d
+}
+
+// SoftLimitReached reports whether the search should stop rather than begin another iteration.
+// The soft limit is multiplied by scale, but never exceeds the hard limit.
+func (gt *GameTimer) SoftLimitReached(scale float64) bool {
+	gt.Lock()
+	defer gt.Unlock()
+	gt.scale = scale
+	return gt.softLimitReached()
+}
+
+func (gt *GameTimer) softLimitReached() bool {
+	if gt.softLimit == 0 { // searching for a fixed time, or not yet started.
+		return false
+	}
+	ponderTime := gt.clockStart.Sub(gt.startTime)
+	limit := clampDuration(time.Duration(float64(gt.softLimit)*gt.scale), 0, ponderTime+gt.hardLimit)
+	return gt.Elapsed() >= limit
+}
+
+// timeScale gives the factor applied to the soft limit after an iteration. More time is used
+// when the best move has changed recently or the score has dropped, and less when most of the
+// search effort went into the best move, suggesting the alternatives were easily refuted.
+func timeScale(instability float64, scoreDrop int, bestNodeShare float64) float64 {
+	scale := 1 + instability*INSTABILITY_WEIGHT
+	scale *= 1 + float64(min(max(scoreDrop, 0), SCORE_DROP_MAX))/SCORE_DROP_MAX*SCORE_DROP_WEIGHT
+	scale *= NODE_SHARE_BASE - bestNodeShare
+	return math.Min(math.Max(scale, MIN_TIME_SCALE), MAX_TIME_SCALE)
 }
 
 func (gt *GameTimer) Elapsed() time.Duration {
@@ -61,9 +153,9 @@ func (gt *GameTimer) Elapsed() time.Duration {
 }
 
 func (gt *GameTimer) Stop() {
+	gt.Lock()
+	defer gt.Unlock()
 	if gt.timer != nil {
 		gt.timer.Stop()
 	}
 }
-
-//
@@ -3,6 +3,23 @@
 // Copyright © 2014 Stephen J. Lovell
 //-----------------------------------------------------------------------------------
 
+// History heuristics for ordering quiet moves:
+//
+// - Butterfly history scores each quiet move by side, piece and destination.
+// - Continuation history scores each quiet move in the context of the previous move (one ply)
+//   and of the move before that (two plies), indexed by the piece and destination of each.
+// - The counter-move table records the quiet move that most recently refuted each previous move.
+//
+// Scores are updated gravity-style: each bonus or malus is scaled down as the score approaches
+// +/-HISTORY_MAX, so that scores stay bounded and recent results carry more weight. The cutoff
+// move receives a bonus, and every quiet move searched before it without causing a cutoff
+// receives a malus. The tables are shared by all workers, so entries are read and updated
+// atomically.
+//
+// History is kept for the duration of a game. Scores are halved before each new search so that
+// results from earlier moves gradually give way to those from the current position, and all
+// tables are cleared when a new game begins.
+
 package main
 
 import (
@@ -10,28 +27,145 @@ import (
 	"sync/atomic"
 )
 
-type HistoryTable [2][8][64]uint32
+const (
+	HISTORY_MAX       = 1 << 14 // history scores are bounded to +/- HISTORY_MAX.
+	HISTORY_BONUS_MAX = 1200    // maximum adjustment made to a history score per cutoff.
+	MAX_QUIETS        = 64      // maximum number of failed quiets penalized per cutoff.
+
+	// the combined score of a quiet move is offset to keep sort keys positive.
+	HISTORY_OFFSET = 3*HISTORY_MAX + 1
+	// counter moves are sorted ahead of other quiet moves.
+	SORT_COUNTER_MOVE = 1 << 20
+)
+
+type HistoryTable struct {
+	butterfly    [2][6][64]int32
+	continuation [2][2][6][64][6][64]int32 // [plies back][side to move][prev piece][prev to][piece][to]
+	counterMoves [2][6][64]Move            // [side to move][prev piece][prev to]
+}
+
+func historyBonus(depth int) int32 {
+	return int32(min(depth*depth, HISTORY_BONUS_MAX))
+}
+
+// updateHistory atomically moves entry toward +/- HISTORY_MAX by bonus, scaled by how far the
+// entry still is from the bound.
+func updateHistory(entry *int32, bonus int32) {
+	for {
+		old := atomic.LoadInt32(entry)
+		updated := old + bonus - old*abs32(bonus)/HISTORY_MAX
+		if atomic.CompareAndSwapInt32(entry, old, updated) {
+			return
+		}
+	}
+}
+
+func abs32(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Update rewards the quiet move m for causing a cutoff at the given depth, and penalizes the
+// quiet moves searched before it. prev holds the previous move and the move before that.
+func (h *HistoryTable) Update(m Move, c uint8, prev [2]Move, quiets []Move, depth int) {
+	bonus := historyBonus(depth)
+	h.update(m, c, prev, bonus)
+	for _, q := range quiets {
+		if q != m {
+			h.update(q, c, prev, -bonus)
+		}
+	}
+	if prev[0].IsMove() {
+		counter := &h.counterMoves[c][prev[0].Piece()][prev[0].To()]
+		atomic.StoreUint32((*uint32)(counter), uint32(m))
+	}
+}
+
+func (h *HistoryTable) update(m Move, c uint8, prev [2]Move, bonus int32) {
+	pc, to := m.Piece(), m.To()
+	updateHistory(&h.butterfly[c][pc][to], bonus)
+	for i, p := range prev {
+		if p.IsMove() {
+			updateHistory(&h.continuation[i][c][p.Piece()][p.To()][pc][to], bonus)
+		}
+	}
+}
+
+// Node returns the history used to order quiet moves for side c at a node reached via prev.
+func (h *HistoryTable) Node(c uint8, prev [2]Move) NodeHistory {
+	nh := NodeHistory{htable: h, prev: prev, counter: NO_MOVE}
+	if h != nil && prev[0].IsMove() {
+		nh.counter = Move(atomic.LoadUint32((*uint32)(&h.counterMoves[c][prev[0].Piece()][prev[0].To()])))
+	}
+	return nh
+}
+
+// NodeHistory combines the history tables with the moves leading to a single node.
+type NodeHistory struct {
+	htable  *HistoryTable
+	prev    [2]Move
+	counter Move
+}
 
-// Store atomically adds count to the history table h.
-func (h *HistoryTable) Store(m Move, c uint8, count int) {
-	atomic.AddUint32(&h[c][m.Piece()][m.To()], uint32((count>>3)|1))
+// Probe returns the sort key for a quiet move by piece pc to square to. A nil table gives
+// every move the same key.
+func (nh *NodeHistory) Probe(pc Piece, c uint8, to int) uint32 {
+	if nh.htable == nil {
+		return 0
+	}
+	h := nh.htable
+	score := atomic.LoadInt32(&h.butterfly[c][pc][to])
+	for i, p := range nh.prev {
+		if p.IsMove() {
+			score += atomic.LoadInt32(&h.continuation[i][c][p.Piece()][p.To()][pc][to])
+		}
+	}
+	key := uint32(score + HISTORY_OFFSET)
+	if nh.counter.IsMove() && nh.counter.Piece() == pc && nh.counter.To() == to {
+		key |= SORT_COUNTER_MOVE
+	}
+	return key
 }
 
-// Probe atomically reads the history table h.
-func (h *HistoryTable) Probe(pc Piece, c uint8, to int) uint32 {
-	if v := atomic.LoadUint32(&h[c][pc][to]); v > 0 {
-		return ((v >> 3) & (uint32(1<<22) - 1)) | 1
+// Age halves each history score. Counter moves are kept. Only call Age while no search is running.
+func (h *HistoryTable) Age() {
+	for c := range h.butterfly {
+		for pc := range h.butterfly[c] {
+			for to := range h.butterfly[c][pc] {
+				h.butterfly[c][pc][to] /= 2
+			}
+		}
+	}
+	for i := range h.continuation {
+		for c := range h.continuation[i] {
+			for prevPc := range h.continuation[i][c] {
+				for prevTo := range h.continuation[i][c][prevPc] {
+					entries := &h.continuation[i][c][prevPc][prevTo]
+					for pc := range entries {
+						for to := range entries[pc] {
+							entries[pc][to] /= 2
+						}
+					}
+				}
+			}
+		}
 	}
-	return 0
+}
+
+// Clear resets all history scores and counter moves. Only call Clear while no search is running.
+func (h *HistoryTable) Clear() {
+	*h = HistoryTable{}
 }
 
 func (h *HistoryTable) PrintMax() {
-	var val uint32
+	var val int32
 	for i := 0; i < 2; i++ {
-		for j := 0; j < 8; j++ {
+		for j := 0; j < 6; j++ {
 			for k := 0; k < 64; k++ {
-				if h[i][j][k] > val {
-					val = h[i][j][k]
+				if h.butterfly[i][j][k] > val {
+					val = h.butterfly[i][j][k]
 				}
 			}
 		}
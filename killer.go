@@ -23,6 +23,13 @@ func (s *StackItem) StoreKiller(m Move) {
 	}
 }
 
+// ClearKillers removes all killer moves from the stack, so that none carry over into a new game.
+func (stk Stack) ClearKillers() {
+	for i := range stk {
+		stk[i].killers = KEntry{}
+	}
+}
+
 func (s *StackItem) IsKiller(m Move) bool {
 	killers := &s.killers
 	return m == killers[0] || m == killers[1] || m == killers[2]
@@ -68,11 +68,22 @@ func printName() {
 var cpuProfileFlag = flag.Bool("cpuprofile", false, "Runs cpu profiler on test suite.")
 var memProfileFlag = flag.Bool("memprofile", false, "Runs memory profiler on test suite.")
 var versionFlag = flag.Bool("version", false, "Prints version number and exits.")
+var paramsFlag = flag.String("params", "", "Loads evaluation parameters from the given file.")
 
 func main() {
 	flag.Parse()
+	if *paramsFlag != "" {
+		if err := loadEvalParams(*paramsFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 	if *versionFlag {
 		printName()
+	} else if flag.Arg(0) == "tune" {
+		runTuneCommand(flag.Args()[1:])
+	} else if flag.Arg(0) == "selfplay" {
+		runSelfPlayCommand(flag.Args()[1:])
 	} else {
 		if *cpuProfileFlag {
 			printName()
@@ -90,3 +101,59 @@ func main() {
 		}
 	}
 }
+
+// checkWorkerFlag exits if a command was asked to create more workers than NewWorker supports.
+func checkWorkerFlag(name string, n int) {
+	if n > MAX_WORKERS {
+		fmt.Printf("-%s must be at most %d\n", name, MAX_WORKERS)
+		os.Exit(2)
+	}
+}
+
+// tune: optimizes evaluation parameters against a file of labeled positions.
+func runTuneCommand(args []string) {
+	tuneFlags := flag.NewFlagSet("tune", flag.ExitOnError)
+	positions := tuneFlags.String("positions", "", "File of labeled positions (FEN plus game result).")
+	out := tuneFlags.String("out", "params.txt", "File to which tuned parameters are written.")
+	workers := tuneFlags.Int("workers", runtime.NumCPU(), "Number of goroutines used to evaluate positions.")
+	iterations := tuneFlags.Int("iterations", 100, "Maximum number of local search iterations.")
+	tuneFlags.Parse(args)
+
+	if *positions == "" {
+		tuneFlags.Usage()
+		os.Exit(2)
+	}
+	checkWorkerFlag("workers", *workers)
+	printName()
+	if err := RunTuner(*positions, *out, *workers, *iterations); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// selfplay: generates training data from fast fixed-node self-play games.
+func runSelfPlayCommand(args []string) {
+	selfPlayFlags := flag.NewFlagSet("selfplay", flag.ExitOnError)
+	games := selfPlayFlags.Int("games", 1000, "Number of games to play.")
+	nodes := selfPlayFlags.Int("nodes", 5000, "Node limit per move.")
+	concurrency := selfPlayFlags.Int("concurrency", runtime.NumCPU(), "Number of games played at once.")
+	randomPlies := selfPlayFlags.Int("random-plies", 8, "Number of random moves played at the start of each game.")
+	book := selfPlayFlags.String("book", "", "File of opening positions (FEN or EPD), one per line.")
+	out := selfPlayFlags.String("out", "selfplay.txt", "File to which positions are written.")
+	selfPlayFlags.Parse(args)
+
+	checkWorkerFlag("concurrency", *concurrency)
+	printName()
+	cfg := SelfPlayConfig{
+		games:       *games,
+		nodes:       max(*nodes, 1),
+		concurrency: max(*concurrency, 1),
+		randomPlies: *randomPlies,
+		bookPath:    *book,
+		outPath:     *out,
+	}
+	if err := RunSelfPlay(cfg); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -12,6 +12,20 @@ const (
 	C_BK = 1 // Black castle king side
 )
 
+const (
+	QUEENSIDE = iota
+	KINGSIDE
+)
+
+var castleFlags = [2][2]uint8{{C_BQ, C_BK}, {C_WQ, C_WK}}
+var castleRights = [2]uint8{C_BK | C_BQ, C_WK | C_WQ}
+
+// In Chess960 the king and rooks may start anywhere on the back rank, but castling always places
+// the king on the c-file or g-file and the rook on the d-file or f-file. These are given as
+// columns, indexed by castling side.
+var castleKingDest = [2]int{2, 6}
+var castleRookDest = [2]int{3, 5}
+
 func makeMove(brd *Board, move Move) {
 	from := move.From()
 	to := move.To()
@@ -59,25 +73,15 @@ func makeMove(brd *Board, move Move) {
 		}
 
 	case KING:
+		if move.IsCastle() {
+			brd.halfmoveClock = 0
+			kingTo, rookTo := castleDestinations(from, move.CastleSide())
+			makeCastle(brd, from, to, kingTo, rookTo, c)
+			break
+		}
 		switch capturedPiece {
 		case EMPTY:
 			brd.halfmoveClock += 1
-			if abs(to-from) == 2 { // king is castling.
-				brd.halfmoveClock = 0
-				if c == WHITE {
-					if to == G1 {
-						relocatePiece(brd, ROOK, H1, F1, c)
-					} else {
-						relocatePiece(brd, ROOK, A1, D1, c)
-					}
-				} else {
-					if to == G8 {
-						relocatePiece(brd, ROOK, H8, F8, c)
-					} else {
-						relocatePiece(brd, ROOK, A8, D8, c)
-					}
-				}
-			}
 		case PAWN:
 			removePiece(brd, capturedPiece, to, brd.Enemy())
 			brd.pawnHashKey ^= pawnZobrist(to, brd.Enemy())
@@ -172,23 +176,14 @@ func unmakeMove(brd *Board, move Move, memento *BoardMemento) {
 		}
 
 	case KING:
+		if move.IsCastle() {
+			kingTo, rookTo := castleDestinations(from, move.CastleSide())
+			unmakeCastle(brd, from, to, kingTo, rookTo, c)
+			break
+		}
 		unmakeRelocateKing(brd, piece, capturedPiece, to, from, c)
 		if capturedPiece != EMPTY {
 			unmakeAddPiece(brd, capturedPiece, to, brd.Enemy())
-		} else if abs(to-from) == 2 { // king castled.
-			if c == WHITE {
-				if to == G1 {
-					unmakeRelocatePiece(brd, ROOK, F1, H1, WHITE)
-				} else {
-					unmakeRelocatePiece(brd, ROOK, D1, A1, WHITE)
-				}
-			} else {
-				if to == G8 {
-					unmakeRelocatePiece(brd, ROOK, F8, H8, BLACK)
-				} else {
-					unmakeRelocatePiece(brd, ROOK, D8, A8, BLACK)
-				}
-			}
 		}
 
 	default:
@@ -203,33 +198,54 @@ func unmakeMove(brd *Board, move Move, memento *BoardMemento) {
 	brd.halfmoveClock = memento.halfmoveClock
 }
 
-// Update castling rights whenever a piece moves from or to a square associated with the
-// current castling rights.
+// Update castling rights whenever the king or a castling rook moves, or a castling rook is captured.
 func updateCastleRights(brd *Board, from, to int) {
-	if castle := brd.castle; castle > 0 && (sqMaskOn[from]|sqMaskOn[to])&castleMasks[castle] > 0 {
-		updateCasleRightsForSq(brd, from)
-		updateCasleRightsForSq(brd, to)
+	castle := brd.castle
+	if castle == 0 {
+		return
+	}
+	fromTo := sqMaskOn[from] | sqMaskOn[to]
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		for side := QUEENSIDE; side <= KINGSIDE; side++ {
+			if castle&castleFlags[c][side] > 0 &&
+				(sqMaskOn[brd.castleRooks[c][side]]|brd.pieces[c][KING])&fromTo > 0 {
+				brd.castle &= ^castleFlags[c][side]
+			}
+		}
+	}
+	if brd.castle != castle { // if brd.castle remains unchanged, hash key will be unchanged.
 		brd.hashKey ^= castleZobrist(castle)
 		brd.hashKey ^= castleZobrist(brd.castle)
 	}
 }
 
-func updateCasleRightsForSq(brd *Board, sq int) {
-	switch sq { // if brd.castle remains unchanged, hash key will be unchanged.
-	case A1:
-		brd.castle &= (^uint8(C_WQ))
-	case E1: // white king starting position
-		brd.castle &= (^uint8(C_WK | C_WQ))
-	case H1:
-		brd.castle &= (^uint8(C_WK))
-	case A8:
-		brd.castle &= (^uint8(C_BQ))
-	case E8: // black king starting position
-		brd.castle &= (^uint8(C_BK | C_BQ))
-	case H8:
-		brd.castle &= (^uint8(C_BK))
-	default:
+// castleDestinations returns the squares on which the king and rook land after castling.
+func castleDestinations(kingSq, side int) (int, int) {
+	r := row(kingSq)
+	return Square(r, castleKingDest[side]), Square(r, castleRookDest[side])
+}
+
+// In Chess960 the king or rook may already be on its destination square, or may land on the
+// starting square of the other piece. Relocations are applied to the bitboards via XOR, so
+// the order doesn't matter there, but the king must be restored on the square table afterward.
+func makeCastle(brd *Board, kingFrom, rookFrom, kingTo, rookTo int, c uint8) {
+	if kingFrom != kingTo {
+		relocateKing(brd, KING, EMPTY, kingFrom, kingTo, c)
 	}
+	if rookFrom != rookTo {
+		relocatePiece(brd, ROOK, rookFrom, rookTo, c)
+	}
+	brd.squares[kingTo] = KING
+}
+
+func unmakeCastle(brd *Board, kingFrom, rookFrom, kingTo, rookTo int, c uint8) {
+	if kingFrom != kingTo {
+		unmakeRelocateKing(brd, KING, EMPTY, kingTo, kingFrom, c)
+	}
+	if rookFrom != rookTo {
+		unmakeRelocatePiece(brd, ROOK, rookTo, rookFrom, c)
+	}
+	brd.squares[kingFrom] = KING
 }
 
 func removePiece(brd *Board, removedPiece Piece, sq int, e uint8) {
@@ -240,7 +256,11 @@ func removePiece(brd *Board, removedPiece Piece, sq int, e uint8) {
 func unmakeRemovePiece(brd *Board, removedPiece Piece, sq int, e uint8) {
 	brd.pieces[e][removedPiece].Clear(sq)
 	brd.occupied[e].Clear(sq)
-	brd.material[e] -= int16(removedPiece.Value() + mainPst[e][removedPiece][sq])
+	brd.material[e] -= materialScores[removedPiece] + mainPst[e][removedPiece][sq]
+	brd.materialKey -= materialZobrist(removedPiece, e)
+	if brd.acc != nil {
+		brd.acc.Remove(removedPiece, sq, e)
+	}
 	brd.endgameCounter -= endgameCountValues[removedPiece]
 }
 
@@ -253,7 +273,11 @@ func unmakeAddPiece(brd *Board, addedPiece Piece, sq int, c uint8) {
 	brd.pieces[c][addedPiece].Add(sq)
 	brd.squares[sq] = addedPiece
 	brd.occupied[c].Add(sq)
-	brd.material[c] += int16(addedPiece.Value() + mainPst[c][addedPiece][sq])
+	brd.material[c] += materialScores[addedPiece] + mainPst[c][addedPiece][sq]
+	brd.materialKey += materialZobrist(addedPiece, c)
+	if brd.acc != nil {
+		brd.acc.Add(addedPiece, sq, c)
+	}
 	brd.endgameCounter += endgameCountValues[addedPiece]
 }
 
@@ -269,7 +293,10 @@ func unmakeRelocatePiece(brd *Board, piece Piece, from, to int, c uint8) {
 	brd.occupied[c] ^= fromTo
 	brd.squares[from] = EMPTY
 	brd.squares[to] = piece
-	brd.material[c] += int16(mainPst[c][piece][to] - mainPst[c][piece][from])
+	brd.material[c] += mainPst[c][piece][to] - mainPst[c][piece][from]
+	if brd.acc != nil {
+		brd.acc.Move(piece, from, to, c)
+	}
 }
 
 func relocateKing(brd *Board, piece, capturedPiece Piece, from, to int, c uint8) {
@@ -284,4 +311,7 @@ func unmakeRelocateKing(brd *Board, piece, capturedPiece Piece, from, to int, c
 	brd.occupied[c] ^= fromTo
 	brd.squares[from] = EMPTY
 	brd.squares[to] = piece
+	if brd.acc != nil {
+		brd.acc.Move(piece, from, to, c)
+	}
 }
@@ -0,0 +1,35 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+const (
+	MATERIAL_ENTRY_COUNT = 8192
+	MATERIAL_TT_MASK     = MATERIAL_ENTRY_COUNT - 1
+)
+
+type MaterialTT [MATERIAL_ENTRY_COUNT]MaterialEntry
+
+// Endgame evaluators return a score from the strong side's point of view.
+type EndgameEvaluator func(brd *Board, strong uint8) int
+
+type MaterialEntry struct {
+	evaluator EndgameEvaluator // specialized evaluation function for known endgames, if any.
+	value     [2]Score         // material imbalance from each side's point of view.
+	phase     int
+	key       uint32
+	scale     [2]uint8 // scales down the endgame score when the given side is ahead.
+	strong    uint8    // the side the evaluator is applied for.
+}
+
+func NewMaterialTT() *MaterialTT {
+	return new(MaterialTT)
+}
+
+// The number of distinct material configurations reached during a search is small, so the
+// hit rate is typically well above 99 %
+func (mtt *MaterialTT) Probe(key uint32) *MaterialEntry {
+	return &mtt[key&MATERIAL_TT_MASK]
+}
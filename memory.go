@@ -95,6 +95,21 @@ func (data BucketData) NewID(id int) BucketData {
 	return (data & BucketData(35184372088831)) | (BucketData(id) << 45)
 }
 
+// hashfull estimates the permille of TT entries written or probed during the search with the given
+// id, by sampling the first thousand buckets.
+func (tt *TT) hashfull(id int) int {
+	count := 0
+	for i := 0; i < 250; i++ {
+		for j := 0; j < 4; j++ {
+			data, key := tt[i][j].Load()
+			if data.Id() == id && data != key { // empty buckets have a key of zero.
+				count++
+			}
+		}
+	}
+	return count
+}
+
 func (tt *TT) getSlot(hashKey uint64) *Slot {
 	return &tt[hashKey&TT_MASK]
 }
@@ -106,7 +121,7 @@ func (tt *TT) probe(brd *Board, depth, nullDepth, alpha, beta int, score *int) (
 	// return NO_MOVE, NO_MATCH  // uncomment to disable transposition table
 
 	var data, key BucketData
-	hashKey := brd.hashKey
+	hashKey, id := brd.hashKey, currentSearchId()
 	slot := tt.getSlot(hashKey)
 
 	for i := 0; i < 4; i++ {
@@ -116,7 +131,7 @@ func (tt *TT) probe(brd *Board, depth, nullDepth, alpha, beta int, score *int) (
 		// due to a data race, the key returned will no longer match and probe() will reject the entry.
 		if hashKey == uint64(data^key) { // look for an entry uncorrupted by lockless access.
 
-			slot[i].Store(data.NewID(searchId), hashKey) // update age (search id) of entry.
+			slot[i].Store(data.NewID(id), hashKey) // update age (search id) of entry.
 
 			entryValue := data.Value()
 			*score = entryValue // set the current search score
@@ -160,7 +175,8 @@ func (tt *TT) store(brd *Board, move Move, depth, entryType, value int) {
 	var key BucketData
 	var data [4]BucketData
 
-	newData := NewData(move, depth, entryType, value, searchId)
+	id := currentSearchId()
+	newData := NewData(move, depth, entryType, value, id)
 
 	for i := 0; i < 4; i++ {
 		data[i], key = slot[i].Load()
@@ -172,7 +188,7 @@ func (tt *TT) store(brd *Board, move Move, depth, entryType, value int) {
 	// If entries from a previous search exist, find/replace shallowest old entry.
 	replaceIndex, replaceDepth := 4, 32
 	for i := 0; i < 4; i++ {
-		if searchId != data[i].Id() { // entry is not from the current search.
+		if id != data[i].Id() { // entry is not from the current search.
 			if data[i].Depth() < replaceDepth {
 				replaceIndex, replaceDepth = i, data[i].Depth()
 			}
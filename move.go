@@ -21,6 +21,9 @@ type Move uint32
 // Piece - next 3 bits
 // Captured piece - next 3 bits
 // promoted to - next 3 bits
+//
+// Castles are encoded as the king capturing its own rook, with the promoted to field set to KING.
+// This allows for Chess960 castles, where the king may start on its destination square.
 
 func (m Move) From() int {
 	return int(uint32(m) & uint32(63))
@@ -47,7 +50,19 @@ func (m Move) IsCapture() bool {
 }
 
 func (m Move) IsPromotion() bool {
-	return m.PromotedTo() != EMPTY
+	return m.Piece() == PAWN && m.PromotedTo() != EMPTY
+}
+
+func (m Move) IsCastle() bool {
+	return m.Piece() == KING && m.PromotedTo() == KING
+}
+
+// CastleSide returns the side of the board toward which the king is castling.
+func (m Move) CastleSide() int {
+	if m.To() > m.From() {
+		return KINGSIDE
+	}
+	return QUEENSIDE
 }
 
 func (m Move) IsQuiet() bool {
@@ -75,19 +90,29 @@ func (m Move) ToString() string { // string representation used for debugging on
 	if m.IsCapture() {
 		str += " x " + pieceChars[m.CapturedPiece()]
 	}
-	if m.IsPromotion() {
+	if m.IsCastle() {
+		str += " castles"
+	} else if m.IsPromotion() {
 		str += " promoted to " + pieceChars[m.PromotedTo()]
 	}
 	return str
 }
 
+// When set, castles are sent as king-takes-rook moves as required by the UCI_Chess960 option.
+// Otherwise castles are sent as a two-square king move.
+var uciChess960 bool
+
 func (m Move) ToUCI() string {
 	if !m.IsMove() {
 		return "0000"
 	}
+	to := m.To()
+	if m.IsCastle() && !uciChess960 {
+		to = Square(row(to), castleKingDest[m.CastleSide()])
+	}
 	str := ParseCoordinates(row(m.From()), column(m.From())) +
-		ParseCoordinates(row(m.To()), column(m.To()))
-	if m.PromotedTo() != EMPTY {
+		ParseCoordinates(row(to), column(to))
+	if m.IsPromotion() {
 		str += pieceChars[m.PromotedTo()]
 	}
 	return str
@@ -98,6 +123,10 @@ func NewMove(from, to int, piece, capturedPiece, promotedTo Piece) Move {
 		(Move(capturedPiece) << 15) | (Move(promotedTo) << 18)
 }
 
+func NewCastle(kingSq, rookSq int) Move {
+	return NewMove(kingSq, rookSq, KING, EMPTY, KING)
+}
+
 func NewRegularMove(from, to int, piece Piece) Move {
 	return Move(from) | (Move(to) << 6) | (Move(piece) << 12) |
 		(Move(EMPTY) << 15) | (Move(EMPTY) << 18)
@@ -5,7 +5,91 @@
 
 package main
 
-func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
+// CanCastle determines if side c may castle toward the given side, assuming c is not in check.
+// This follows the Chess960 rules, which reduce to the usual rules for standard chess: all
+// squares traveled by the king and rook must be empty other than those occupied by the castling
+// king and rook, and the king may not pass through or land on an attacked square.
+func (brd *Board) CanCastle(c uint8, side int) bool {
+	if brd.castle&castleFlags[c][side] == 0 {
+		return false
+	}
+	kingSq, rookSq := brd.KingSq(c), int(brd.castleRooks[c][side])
+	kingTo, rookTo := castleDestinations(kingSq, side)
+	kingPath := intervening[kingSq][kingTo] | sqMaskOn[kingTo]
+	rookPath := intervening[rookSq][rookTo] | sqMaskOn[rookTo]
+	// The castling rook is removed from the occupancy so that attacks on the king's path from
+	// behind the rook are detected.
+	occ := brd.AllOccupied() & sqMaskOff[kingSq] & sqMaskOff[rookSq]
+	if (kingPath|rookPath)&occ > 0 {
+		return false
+	}
+	e := c ^ 1
+	var sq int
+	for ; kingPath > 0; kingPath.Clear(sq) {
+		sq = lsb(kingPath)
+		if isAttackedBy(brd, occ, sq, e, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// The search only considers promotions to queen or knight. Since the promoted piece has no bearing
+// on the legality of a promotion, the remaining promotions can be added alongside each queen
+// promotion wherever every legal move is needed.
+var underpromotions = [2]Piece{ROOK, BISHOP}
+
+func underpromotion(m Move, pc Piece) Move {
+	return NewMove(m.From(), m.To(), PAWN, m.CapturedPiece(), pc)
+}
+
+// An empty history table, used where move ordering doesn't matter. It's never updated, so it's
+// safe to share between goroutines.
+var noHistory NodeHistory
+
+// PseudoLegalMoves returns the moves available to the side to move, some of which may leave the
+// king in check. When in check, only check evasions are generated. Unlike the move selector,
+// all promotions are included.
+func (brd *Board) PseudoLegalMoves() []Move {
+	return brd.pseudoLegalMoves(brd.InCheck())
+}
+
+// LegalMoves returns the legal moves available to the side to move, including all promotions.
+func (brd *Board) LegalMoves() []Move {
+	inCheck := brd.InCheck()
+	moves := brd.pseudoLegalMoves(inCheck)
+	legalMoves := moves[:0]
+	for _, m := range moves {
+		if brd.AvoidsCheck(m, inCheck) {
+			legalMoves = append(legalMoves, m)
+		}
+	}
+	return legalMoves
+}
+
+func (brd *Board) pseudoLegalMoves(inCheck bool) []Move {
+	var winning, losing, remainingMoves MoveList
+	if inCheck {
+		getEvasions(brd, &noHistory, &winning, &losing, &remainingMoves)
+	} else {
+		getCaptures(brd, &noHistory, &winning, &losing)
+		getNonCaptures(brd, &noHistory, &remainingMoves)
+	}
+	moves := make([]Move, 0, len(winning)+len(losing)+len(remainingMoves))
+	for _, list := range [3]MoveList{winning, losing, remainingMoves} {
+		for _, item := range list {
+			moves = append(moves, item.move)
+			if item.move.IsPromotion() && item.move.PromotedTo() == QUEEN {
+				for _, pc := range underpromotions {
+					moves = append(moves, underpromotion(item.move, pc))
+				}
+			}
+		}
+	}
+	return moves
+}
+
+func getNonCaptures(brd *Board, hist *NodeHistory, remainingMoves *MoveList) {
 	var from, to int
 	var singleAdvances, doubleAdvances BB
 	c := brd.c
@@ -14,30 +98,11 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 	var m Move
 
 	// Castles
-	castle := brd.castle
-	if castle > uint8(0) { // get_non_captures is only called when not in check.
-		e := brd.Enemy()
-		if c == WHITE {
-			if (castle&C_WQ > uint8(0)) && castleQueensideIntervening[WHITE]&occ == 0 &&
-				!isAttackedBy(brd, occ, C1, e, c) && !isAttackedBy(brd, occ, D1, e, c) {
-				m = NewRegularMove(E1, C1, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, C1) | 1, m})
-			}
-			if (castle&C_WK > uint8(0)) && castleKingsideIntervening[WHITE]&occ == 0 &&
-				!isAttackedBy(brd, occ, F1, e, c) && !isAttackedBy(brd, occ, G1, e, c) {
-				m = NewRegularMove(E1, G1, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, G1) | 1, m})
-			}
-		} else {
-			if (castle&C_BQ > uint8(0)) && castleQueensideIntervening[BLACK]&occ == 0 &&
-				!isAttackedBy(brd, occ, C8, e, c) && !isAttackedBy(brd, occ, D8, e, c) {
-				m = NewRegularMove(E8, C8, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, C8) | 1, m})
-			}
-			if (castle&C_BK > uint8(0)) && castleKingsideIntervening[BLACK]&occ == 0 &&
-				!isAttackedBy(brd, occ, F8, e, c) && !isAttackedBy(brd, occ, G8, e, c) {
-				m = NewRegularMove(E8, G8, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, G8) | 1, m})
+	if brd.castle&castleRights[c] > 0 { // get_non_captures is only called when not in check.
+		for side := QUEENSIDE; side <= KINGSIDE; side++ {
+			if brd.CanCastle(c, side) {
+				m = NewCastle(brd.KingSq(c), int(brd.castleRooks[c][side]))
+				remainingMoves.Push(SortItem{hist.Probe(KING, c, m.To()) | 1, m})
 			}
 		}
 	}
@@ -60,13 +125,13 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 		to = furthestForward(c, doubleAdvances)
 		from = to + pawnFromOffsets[c][OFF_DOUBLE]
 		m = NewRegularMove(from, to, PAWN)
-		remainingMoves.Push(SortItem{htable.Probe(PAWN, c, to), m})
+		remainingMoves.Push(SortItem{hist.Probe(PAWN, c, to), m})
 	}
 	for ; singleAdvances > 0; singleAdvances.Clear(to) {
 		to = furthestForward(c, singleAdvances)
 		from = to + pawnFromOffsets[c][OFF_SINGLE]
 		m = NewRegularMove(from, to, PAWN)
-		remainingMoves.Push(SortItem{htable.Probe(PAWN, c, to), m})
+		remainingMoves.Push(SortItem{hist.Probe(PAWN, c, to), m})
 	}
 	// Knights
 	for f := brd.pieces[c][KNIGHT]; f > 0; f.Clear(from) {
@@ -74,7 +139,7 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 		for t := (knightMasks[from] & empty); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, KNIGHT)
-			remainingMoves.Push(SortItem{htable.Probe(KNIGHT, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(KNIGHT, c, to), m})
 		}
 	}
 	// Bishops
@@ -83,7 +148,7 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 		for t := (bishopAttacks(occ, from) & empty); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, BISHOP)
-			remainingMoves.Push(SortItem{htable.Probe(BISHOP, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(BISHOP, c, to), m})
 		}
 	}
 	// Rooks
@@ -92,7 +157,7 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 		for t := (rookAttacks(occ, from) & empty); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, ROOK)
-			remainingMoves.Push(SortItem{htable.Probe(ROOK, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(ROOK, c, to), m})
 		}
 	}
 	// Queens
@@ -101,7 +166,7 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 		for t := (queenAttacks(occ, from) & empty); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, QUEEN)
-			remainingMoves.Push(SortItem{htable.Probe(QUEEN, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(QUEEN, c, to), m})
 		}
 	}
 	// Kings
@@ -110,13 +175,13 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 		for t := (kingMasks[from] & empty); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, KING)
-			remainingMoves.Push(SortItem{htable.Probe(KING, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(KING, c, to), m})
 		}
 	}
 }
 
 // Pawn promotions are also generated during get_captures routine.
-func getCaptures(brd *Board, htable *HistoryTable, winning, losing *MoveList) {
+func getCaptures(brd *Board, hist *NodeHistory, winning, losing *MoveList) {
 	var from, to int
 	var m Move
 
@@ -268,7 +333,7 @@ func getCaptures(brd *Board, htable *HistoryTable, winning, losing *MoveList) {
 	}
 }
 
-func getWinningCaptures(brd *Board, htable *HistoryTable, winning *MoveList) {
+func getWinningCaptures(brd *Board, hist *NodeHistory, winning *MoveList) {
 	var from, to int
 	var m Move
 
@@ -413,7 +478,7 @@ func getWinningCaptures(brd *Board, htable *HistoryTable, winning *MoveList) {
 	}
 }
 
-func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMoves *MoveList) {
+func getEvasions(brd *Board, hist *NodeHistory, winning, losing, remainingMoves *MoveList) {
 	c, e := brd.c, brd.Enemy()
 
 	var defenseMap BB
@@ -530,11 +595,11 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 				} else {
 					to = int(enpTarget) - 8
 				}
-				// In addition to making sure this capture will get the king out of check and that
-				// the piece is not pinned, verify that removing the enemy pawn does not leave the
-				// king in check.
-				if (sqMaskOn[to]&defenseMap) > 0 && isPinned(brd, occ&sqMaskOff[enpTarget],
-					m.From(), brd.c, brd.Enemy())&sqMaskOn[m.To()] > 0 {
+				// In addition to making sure this capture will get the king out of check (either by
+				// capturing the checking pawn or by blocking) and that the piece is not pinned, verify
+				// that removing the enemy pawn does not leave the king in check.
+				if (sqMaskOn[to]|sqMaskOn[enpTarget])&defenseMap > 0 && isPinned(brd,
+					occ&sqMaskOff[enpTarget], from, c, e)&sqMaskOn[to] > 0 {
 					m = NewCapture(from, to, PAWN, PAWN)
 					winning.Push(SortItem{SortCapture(PAWN, PAWN, 0), m})
 				}
@@ -546,7 +611,7 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 			from = to + pawnFromOffsets[c][OFF_DOUBLE]
 			if pinnedCanMove(brd, from, to, c, e) {
 				m = NewRegularMove(from, to, PAWN)
-				remainingMoves.Push(SortItem{htable.Probe(PAWN, c, to), m})
+				remainingMoves.Push(SortItem{hist.Probe(PAWN, c, to), m})
 			}
 		}
 		// single advances
@@ -555,7 +620,7 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 			from = to + pawnFromOffsets[c][OFF_SINGLE]
 			if pinnedCanMove(brd, from, to, c, e) {
 				m = NewRegularMove(from, to, PAWN)
-				remainingMoves.Push(SortItem{htable.Probe(PAWN, c, to), m})
+				remainingMoves.Push(SortItem{hist.Probe(PAWN, c, to), m})
 			}
 		}
 		var see int
@@ -577,7 +642,7 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 						}
 					} else {
 						m = NewRegularMove(from, to, KNIGHT)
-						remainingMoves.Push(SortItem{htable.Probe(KNIGHT, c, to), m})
+						remainingMoves.Push(SortItem{hist.Probe(KNIGHT, c, to), m})
 					}
 				}
 			}
@@ -598,7 +663,7 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 						}
 					} else {
 						m = NewRegularMove(from, to, BISHOP)
-						remainingMoves.Push(SortItem{htable.Probe(BISHOP, c, to), m})
+						remainingMoves.Push(SortItem{hist.Probe(BISHOP, c, to), m})
 					}
 				}
 			}
@@ -619,7 +684,7 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 						}
 					} else {
 						m = NewRegularMove(from, to, ROOK)
-						remainingMoves.Push(SortItem{htable.Probe(ROOK, c, to), m})
+						remainingMoves.Push(SortItem{hist.Probe(ROOK, c, to), m})
 					}
 				}
 			}
@@ -640,7 +705,7 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 						}
 					} else {
 						m = NewRegularMove(from, to, QUEEN)
-						remainingMoves.Push(SortItem{htable.Probe(QUEEN, c, to), m})
+						remainingMoves.Push(SortItem{hist.Probe(QUEEN, c, to), m})
 					}
 				}
 			}
@@ -662,12 +727,12 @@ func getEvasions(brd *Board, htable *HistoryTable, winning, losing, remainingMov
 		if !isAttackedBy(brd, occ, to, e, c) && threatDir1 != directions[kingSq][to] &&
 			threatDir2 != directions[kingSq][to] {
 			m = NewRegularMove(kingSq, to, KING)
-			remainingMoves.Push(SortItem{htable.Probe(KING, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(KING, c, to), m})
 		}
 	}
 }
 
-func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
+func getChecks(brd *Board, hist *NodeHistory, remainingMoves *MoveList) {
 	c, e := brd.c, brd.Enemy()
 	kingSq := brd.KingSq(e)
 	var f, t, singleAdvances, target, queenTarget BB
@@ -687,7 +752,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 		from = to + pawnFromOffsets[c][OFF_SINGLE]
 		if getSee(brd, from, to, EMPTY) >= 0 { // make sure the checking piece won't be immediately recaptured
 			m = NewRegularMove(from, to, PAWN)
-			remainingMoves.Push(SortItem{htable.Probe(PAWN, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(PAWN, c, to), m})
 		}
 	}
 	// Knight direct checks
@@ -698,7 +763,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 			to = furthestForward(c, t)
 			if getSee(brd, from, to, EMPTY) >= 0 {
 				m = NewRegularMove(from, to, KNIGHT)
-				remainingMoves.Push(SortItem{htable.Probe(KNIGHT, c, to), m})
+				remainingMoves.Push(SortItem{hist.Probe(KNIGHT, c, to), m})
 			}
 		}
 	}
@@ -711,7 +776,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 			to = furthestForward(c, t)
 			if getSee(brd, from, to, EMPTY) >= 0 {
 				m = NewRegularMove(from, to, BISHOP)
-				remainingMoves.Push(SortItem{htable.Probe(BISHOP, c, to), m})
+				remainingMoves.Push(SortItem{hist.Probe(BISHOP, c, to), m})
 			}
 		}
 	}
@@ -724,7 +789,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 			to = furthestForward(c, t)
 			if getSee(brd, from, to, EMPTY) >= 0 {
 				m = NewRegularMove(from, to, ROOK)
-				remainingMoves.Push(SortItem{htable.Probe(ROOK, c, to), m})
+				remainingMoves.Push(SortItem{hist.Probe(ROOK, c, to), m})
 			}
 		}
 	}
@@ -735,7 +800,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 			to = furthestForward(c, t)
 			if getSee(brd, from, to, EMPTY) >= 0 {
 				m = NewRegularMove(from, to, QUEEN)
-				remainingMoves.Push(SortItem{htable.Probe(QUEEN, c, to), m})
+				remainingMoves.Push(SortItem{hist.Probe(QUEEN, c, to), m})
 			}
 		}
 	}
@@ -771,7 +836,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 		to = furthestForward(c, t)
 		from = to + pawnFromOffsets[c][OFF_SINGLE]
 		m = NewRegularMove(from, to, PAWN)
-		remainingMoves.Push(SortItem{htable.Probe(PAWN, c, to), m})
+		remainingMoves.Push(SortItem{hist.Probe(PAWN, c, to), m})
 	}
 	// Knights
 	for f = brd.pieces[c][KNIGHT] & (bishopBlockers | rookBlockers); f > 0; f.Clear(from) {
@@ -779,7 +844,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 		for t = (knightMasks[from] & empty); t > 0; t.Clear(to) {
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, KNIGHT)
-			remainingMoves.Push(SortItem{htable.Probe(KNIGHT, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(KNIGHT, c, to), m})
 		}
 	}
 	// Bishops
@@ -789,7 +854,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 		for t = (bishopAttacks(occ, from) & unblockPath); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, BISHOP)
-			remainingMoves.Push(SortItem{htable.Probe(BISHOP, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(BISHOP, c, to), m})
 		}
 	}
 	// Rooks
@@ -799,7 +864,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 		for t = (rookAttacks(occ, from) & unblockPath); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, ROOK)
-			remainingMoves.Push(SortItem{htable.Probe(ROOK, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(ROOK, c, to), m})
 		}
 	}
 	// Queens cannot give discovered check, since the enemy king would already be in check.
@@ -811,7 +876,7 @@ func getChecks(brd *Board, htable *HistoryTable, remainingMoves *MoveList) {
 		for t := (kingMasks[from] & unblockPath); t > 0; t.Clear(to) { // generate to squares
 			to = furthestForward(c, t)
 			m = NewRegularMove(from, to, KING)
-			remainingMoves.Push(SortItem{htable.Probe(KING, c, to), m})
+			remainingMoves.Push(SortItem{hist.Probe(KING, c, to), m})
 		}
 	}
 
@@ -7,9 +7,10 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
-	// "testing"
 	"time"
 )
 
@@ -17,7 +18,93 @@ var legalMaxTree = [10]int{1, 20, 400, 8902, 197281, 4865609, 119060324, 3195901
 
 func TestLegalMoveGen(t *testing.T) {
 	depth := 5
-	legalMovegen(Perft, StartPos(), depth, legalMaxTree[depth], true)
+	legalMovegen(StartPos(), depth, legalMaxTree[depth], true)
+}
+
+// Positions from http://www.rocechess.ch/perft.html
+func TestPerftSuite(t *testing.T) {
+	depth := 5
+	if testing.Short() {
+		depth = 3
+	}
+	runPerftSuite(t, "test_suites/perftsuite.epd", depth)
+}
+
+// Chess960 positions from https://www.chessprogramming.org/Chess960_Perft_Results
+func TestChess960Perft(t *testing.T) {
+	depth := 5
+	if testing.Short() {
+		depth = 3
+	}
+	runPerftSuite(t, "test_suites/chess960.epd", depth)
+}
+
+// The table is small enough that entries are overwritten, and the second count is served mostly
+// from entries stored by the first.
+func TestPerftTT(t *testing.T) {
+	kiwipete := ParseFENString("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	tt := NewPerftTT(1)
+	for i := 0; i < 2; i++ {
+		if nodes := Perft(kiwipete, 4, 4, tt); nodes != 4085603 {
+			t.Errorf("expected 4085603 nodes, got %d", nodes)
+		}
+	}
+}
+
+func TestLegalMoves(t *testing.T) {
+	testPositions, err := loadEpdFile("test_suites/perftsuite.epd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// en-passant captures of a checking pawn must be generated as evasions.
+	testPositions = append(testPositions, ParseEPDString("8/8/8/2k5/3Pp3/8/8/4K3 b - d3 0 1 ;D1 9"))
+	for _, epd := range testPositions {
+		moves := epd.brd.LegalMoves()
+		if len(moves) != epd.nodeCount[1] {
+			t.Errorf("%s\nexpected %d legal moves, got %d", epd.fen, epd.nodeCount[1], len(moves))
+		}
+		if len(epd.brd.PseudoLegalMoves()) < len(moves) {
+			t.Errorf("%s\nfewer pseudo-legal moves than legal moves", epd.fen)
+		}
+		memento := epd.brd.NewMemento()
+		for _, m := range moves {
+			makeMove(epd.brd, m)
+			if isAttackedBy(epd.brd, epd.brd.AllOccupied(), epd.brd.KingSq(epd.brd.Enemy()), epd.brd.c,
+				epd.brd.Enemy()) {
+				t.Errorf("%s\n%s leaves the king in check", epd.fen, m.ToUCI())
+			}
+			unmakeMove(epd.brd, m, memento)
+		}
+	}
+}
+
+// runPerftSuite checks the node count of each position in the given EPD file in parallel. When a
+// count is wrong, the divide output is reported so that the failing subtree can be compared
+// against another engine.
+func runPerftSuite(t *testing.T, path string, depth int) {
+	testPositions, err := loadEpdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, epd := range testPositions {
+		expected, ok := epd.nodeCount[depth]
+		if !ok {
+			continue
+		}
+		epd := epd
+		t.Run(strconv.Itoa(i+1), func(t *testing.T) {
+			t.Parallel()
+			if sum := newPerftWorker(nil).perft(epd.brd.Copy(), depth, 0); sum != expected {
+				var divide []string
+				for _, result := range Divide(epd.brd, depth, 1, nil) {
+					divide = append(divide, fmt.Sprintf("%s: %d", result.move.ToUCI(), result.nodes))
+				}
+				sort.Strings(divide)
+				t.Errorf("%s\nexpected %d nodes at depth %d, got %d\n%s", epd.fen, expected, depth, sum,
+					strings.Join(divide, "\n"))
+			}
+		})
+	}
 }
 
 // func TestMoveValidation(t *testing.T) {
@@ -25,32 +112,11 @@ func TestLegalMoveGen(t *testing.T) {
 // 	legal_movegen(PerftValidation, StartPos(), depth, legal_max_tree[depth], true)
 // }
 
-// func TestPerftSuite(t *testing.T) {
-// 	depth := 6
-// 	testPositions, err := loadEpdFile("test_suites/perftsuite.epd") // http://www.rocechess.ch/perft.html
-// 	if err != nil {
-// 		panic("could not load epd file")
-// 	}
-//
-// 	for i, epd := range testPositions {
-// 		if expected, ok := epd.nodeCount[depth]; ok {
-// 			fmt.Printf("%d.", i+1)
-// 			epd.brd.Print()
-// 			fmt.Println(epd.fen)
-// 			legalMovegen(Perft, epd.brd, depth, expected, false)
-// 		}
-// 	}
-// }
-
-// TODO: add parallelism
-
-func legalMovegen(fn func(*Board, *HistoryTable, Stack, int, int) int, brd *Board, depth, expected int, verbose bool) {
-	htable := new(HistoryTable)
+func legalMovegen(brd *Board, depth, expected int, verbose bool) {
 	copy := brd.Copy()
 	start := time.Now()
-	stk := make(Stack, MAX_STACK, MAX_STACK)
 
-	sum := fn(brd, htable, stk, depth, 0)
+	sum := newPerftWorker(nil).perft(brd, depth, 0)
 
 	if verbose {
 		elapsed := time.Since(start)
@@ -62,26 +128,6 @@ func legalMovegen(fn func(*Board, *HistoryTable, Stack, int, int) int, brd *Boar
 	assert(sum == expected, "Expected "+strconv.Itoa(expected)+" nodes, got "+strconv.Itoa(sum))
 }
 
-func Perft(brd *Board, htable *HistoryTable, stk Stack, depth, ply int) int {
-	sum := 0
-	inCheck := brd.InCheck()
-	thisStk := stk[ply]
-	memento := brd.NewMemento()
-	recycler := loadBalancer.RootWorker().recycler
-	generator := NewMoveSelector(brd, &thisStk, htable, inCheck, NO_MOVE)
-	for m, _ := generator.Next(recycler, SP_NONE); m != NO_MOVE; m, _ = generator.Next(recycler, SP_NONE) {
-		if depth > 1 {
-			makeMove(brd, m)
-			sum += Perft(brd, htable, stk, depth-1, ply+1)
-			unmakeMove(brd, m, memento)
-		} else {
-			sum += 1
-		}
-	}
-
-	return sum
-}
-
 func PerftValidation(brd *Board, htable *HistoryTable, stk Stack, depth, ply int) int {
 	if depth == 0 {
 		return 1
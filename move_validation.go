@@ -34,8 +34,8 @@ func (brd *Board) PseudolegalAvoidsCheck(m Move) bool {
 		}
 	case KNIGHT: // Knights can never move when pinned.
 		return isPinned(brd, brd.AllOccupied(), m.From(), brd.c, brd.Enemy()) == BB(ANY_SQUARE_MASK)
-	case KING:
-		return !isAttackedBy(brd, brd.AllOccupied(), m.To(), brd.Enemy(), brd.c)
+	case KING: // legality of castles is fully determined by ValidMove.
+		return m.IsCastle() || !isAttackedBy(brd, brd.AllOccupied(), m.To(), brd.Enemy(), brd.c)
 	default:
 		return pinnedCanMove(brd, m.From(), m.To(), brd.c, brd.Enemy())
 	}
@@ -72,12 +72,15 @@ func (brd *Board) EvadesCheck(m Move) bool {
 	if popCount(threats) > 1 {
 		return false // only king moves can escape from double check.
 	}
-	if (threats|intervening[furthestForward(e, threats)][kingSq])&sqMaskOn[to] == 0 {
-		return false // the moving piece must kill or block the attacking piece.
-	}
+	defenseMap := threats | intervening[furthestForward(e, threats)][kingSq]
 	if brd.enpTarget != SQ_INVALID && piece == PAWN && m.CapturedPiece() == PAWN && // En-passant
 		brd.TypeAt(to) == EMPTY {
-		return isPinned(brd, occ&sqMaskOff[brd.enpTarget], from, c, e)&sqMaskOn[to] > 0
+		// the captured pawn may be the attacking piece.
+		return (sqMaskOn[to]|sqMaskOn[brd.enpTarget])&defenseMap > 0 &&
+			isPinned(brd, occ&sqMaskOff[brd.enpTarget], from, c, e)&sqMaskOn[to] > 0
+	}
+	if defenseMap&sqMaskOn[to] == 0 {
+		return false // the moving piece must kill or block the attacking piece.
 	}
 	return pinnedCanMove(brd, from, to, c, e) // the moving piece can't be pinned to the king.
 }
@@ -87,13 +90,17 @@ func (brd *Board) ValidMove(m Move, inCheck bool) bool {
 	if !m.IsMove() {
 		return false
 	}
-	c, e := brd.c, brd.Enemy()
+	c := brd.c
 	piece, from, to, capturedPiece := m.Piece(), m.From(), m.To(), m.CapturedPiece()
 	// Check that the piece is of the correct type and color.
 	if brd.TypeAt(from) != piece || brd.pieces[c][piece]&sqMaskOn[from] == 0 {
 		// fmt.Printf("No piece of this type available at from square!{%s}", m.ToString())
 		return false
 	}
+	if m.IsCastle() {
+		side := m.CastleSide()
+		return !inCheck && int(brd.castleRooks[c][side]) == to && brd.CanCastle(c, side)
+	}
 	if sqMaskOn[to]&brd.occupied[c] > 0 {
 		// fmt.Printf("To square occupied by own piece!{%s}", m.ToString())
 		return false
@@ -132,45 +139,8 @@ func (brd *Board) ValidMove(m Move, inCheck bool) bool {
 			return brd.TypeAt(to) == capturedPiece
 		}
 
-	case KING:
-
-		if abs(to-from) == 2 { // validate castle moves
-			if inCheck {
-				return false
-			}
-			occ := brd.AllOccupied()
-			castle := brd.castle
-			if c == WHITE {
-				switch to {
-				case C1:
-					if (castle&C_WQ > uint8(0)) && castleQueensideIntervening[WHITE]&occ == 0 &&
-						!isAttackedBy(brd, occ, C1, e, c) && !isAttackedBy(brd, occ, D1, e, c) {
-						return true
-					}
-				case G1:
-					if (castle&C_WK > uint8(0)) && castleKingsideIntervening[WHITE]&occ == 0 &&
-						!isAttackedBy(brd, occ, F1, e, c) && !isAttackedBy(brd, occ, G1, e, c) {
-						return true
-					}
-				}
-			} else {
-				switch to {
-				case C8:
-					if (castle&C_BQ > uint8(0)) && castleQueensideIntervening[BLACK]&occ == 0 &&
-						!isAttackedBy(brd, occ, C8, e, c) && !isAttackedBy(brd, occ, D8, e, c) {
-						return true
-					}
-				case G8:
-					if (castle&C_BK > uint8(0)) && castleKingsideIntervening[BLACK]&occ == 0 &&
-						!isAttackedBy(brd, occ, F8, e, c) && !isAttackedBy(brd, occ, G8, e, c) {
-						return true
-					}
-				}
-			}
-			return false
-		}
-	case KNIGHT:
-		// no special treatment needed for knights.
+	case KING, KNIGHT:
+		// no special treatment needed for kings or knights.
 	default:
 		if slidingAttacks(piece, brd.AllOccupied(), from)&sqMaskOn[to] == 0 {
 			return false
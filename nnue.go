@@ -0,0 +1,213 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Efficiently updatable neural network (NNUE) evaluation.
+
+// The network has a single hidden layer shared by both perspectives, i.e. (768 -> N) x 2 -> 1.
+// Each of the 768 inputs represents a (color, piece type, square) combination, as seen from the
+// point of view of either white or black. The hidden layer values for each perspective are kept
+// in an Accumulator, which is updated incrementally as pieces are added, removed, and moved on
+// the board, so that only the output layer needs to be computed at each evaluation.
+
+// Network files use the raw quantized layout written by the bullet trainer for this architecture
+// (https://github.com/jw1912/bullet). All values are little-endian int16:
+//
+//   feature weights   [768][N]  (quantized by NNUE_QA)
+//   feature biases    [N]       (quantized by NNUE_QA)
+//   output weights    [2N]      (quantized by NNUE_QB; side to move first, then the other side)
+//   output bias       [1]       (quantized by NNUE_QA * NNUE_QB)
+//
+// followed by up to 64 bytes of zero padding. The hidden layer size N is inferred from the file
+// size. Hidden layer values are activated using SCReLU (squared clipped ReLU).
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	NNUE_INPUTS = 768
+	NNUE_QA     = 255
+	NNUE_QB     = 64
+	NNUE_SCALE  = 400 // converts network output to centipawns.
+)
+
+type Network struct {
+	featureWeights []int16
+	featureBiases  []int16
+	outputWeights  []int16
+	outputBias     int16
+	hiddenSize     int
+}
+
+// The currently loaded network, if any. NNUE evaluation is used when a network has been loaded
+// and the UseNNUE option is enabled; otherwise the handcrafted evaluation is used.
+var nnueNetwork *Network
+var useNNUE bool
+
+func LoadNetwork(path string) (*Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNetwork(data)
+}
+
+func ParseNetwork(data []byte) (*Network, error) {
+	values := len(data) / 2
+	// N feature weights per input, plus N feature biases, 2N output weights and 1 output bias.
+	hiddenSize := (values - 1) / (NNUE_INPUTS + 3)
+	size := 2 * ((NNUE_INPUTS+3)*hiddenSize + 1)
+	if hiddenSize == 0 || len(data)-size >= 64 {
+		return nil, fmt.Errorf("network file size %d does not match a (%d->N)x2->1 network",
+			len(data), NNUE_INPUTS)
+	}
+	for _, b := range data[size:] {
+		if b != 0 {
+			return nil, fmt.Errorf("network file has non-zero data after the output bias")
+		}
+	}
+	read := func(count int) []int16 {
+		out := make([]int16, count)
+		for i := range out {
+			out[i] = int16(binary.LittleEndian.Uint16(data[:2]))
+			data = data[2:]
+		}
+		return out
+	}
+	net := &Network{hiddenSize: hiddenSize}
+	net.featureWeights = read(NNUE_INPUTS * hiddenSize)
+	net.featureBiases = read(hiddenSize)
+	net.outputWeights = read(2 * hiddenSize)
+	net.outputBias = read(1)[0]
+	return net, nil
+}
+
+// featureIndex returns the input index for a piece of color c on sq, from the point of view of
+// perspective. Black's perspective is flipped vertically so that both sides see their own pieces
+// from the bottom of the board.
+func featureIndex(perspective uint8, pc Piece, sq int, c uint8) int {
+	if perspective == BLACK {
+		sq ^= 56
+	}
+	if c == perspective {
+		return int(pc)*64 + sq
+	}
+	return 384 + int(pc)*64 + sq
+}
+
+type Accumulator struct {
+	values [2][]int16 // hidden layer values for each perspective.
+	net    *Network
+}
+
+func NewAccumulator(net *Network) *Accumulator {
+	return &Accumulator{
+		values: [2][]int16{make([]int16, net.hiddenSize), make([]int16, net.hiddenSize)},
+		net:    net,
+	}
+}
+
+// Copy returns a deep copy of acc. Copying a nil accumulator returns nil.
+func (acc *Accumulator) Copy() *Accumulator {
+	if acc == nil {
+		return nil
+	}
+	cpy := NewAccumulator(acc.net)
+	acc.CopyTo(cpy)
+	return cpy
+}
+
+// CopyTo overwrites the hidden layer values of dst, which must use the same network as acc.
+func (acc *Accumulator) CopyTo(dst *Accumulator) {
+	copy(dst.values[WHITE], acc.values[WHITE])
+	copy(dst.values[BLACK], acc.values[BLACK])
+}
+
+// Refresh recomputes the hidden layer values from scratch for the pieces on brd.
+func (acc *Accumulator) Refresh(brd *Board) {
+	copy(acc.values[WHITE], acc.net.featureBiases)
+	copy(acc.values[BLACK], acc.net.featureBiases)
+	var sq int
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		for pc := Piece(PAWN); pc <= KING; pc++ {
+			for b := brd.pieces[c][pc]; b > 0; b.Clear(sq) {
+				sq = lsb(b)
+				acc.Add(pc, sq, c)
+			}
+		}
+	}
+}
+
+func (acc *Accumulator) weights(perspective uint8, pc Piece, sq int, c uint8) []int16 {
+	n := acc.net.hiddenSize
+	i := featureIndex(perspective, pc, sq, c) * n
+	return acc.net.featureWeights[i : i+n]
+}
+
+func (acc *Accumulator) Add(pc Piece, sq int, c uint8) {
+	for p := uint8(BLACK); p <= WHITE; p++ {
+		values, w := acc.values[p], acc.weights(p, pc, sq, c)
+		for i := range values {
+			values[i] += w[i]
+		}
+	}
+}
+
+func (acc *Accumulator) Remove(pc Piece, sq int, c uint8) {
+	for p := uint8(BLACK); p <= WHITE; p++ {
+		values, w := acc.values[p], acc.weights(p, pc, sq, c)
+		for i := range values {
+			values[i] -= w[i]
+		}
+	}
+}
+
+func (acc *Accumulator) Move(pc Piece, from, to int, c uint8) {
+	for p := uint8(BLACK); p <= WHITE; p++ {
+		values := acc.values[p]
+		fromW, toW := acc.weights(p, pc, from, c), acc.weights(p, pc, to, c)
+		for i := range values {
+			values[i] += toW[i] - fromW[i]
+		}
+	}
+}
+
+// Evaluate returns the network's evaluation in centipawns from the point of view of side c. The
+// result is kept below MIN_MATE, so that it can't be mistaken for a checkmate score.
+func (acc *Accumulator) Evaluate(c uint8) int {
+	n := acc.net.hiddenSize
+	ow := acc.net.outputWeights
+	var sum int64
+	for i, v := range acc.values[c] {
+		sum += screlu(v) * int64(ow[i])
+	}
+	for i, v := range acc.values[c^1] {
+		sum += screlu(v) * int64(ow[n+i])
+	}
+	sum = sum/NNUE_QA + int64(acc.net.outputBias)
+	score := int(sum * NNUE_SCALE / (NNUE_QA * NNUE_QB))
+	return min(max(score, -(MIN_MATE-1)), MIN_MATE-1)
+}
+
+func screlu(v int16) int64 {
+	x := int64(min(max(int(v), 0), NNUE_QA))
+	return x * x
+}
+
+// InitAccumulator attaches an accumulator for the loaded network to brd if NNUE evaluation is
+// enabled, or removes it otherwise. brd is the root of a search by brd.worker, and uses the
+// worker's accumulator storage for the root.
+func (brd *Board) InitAccumulator() {
+	if !useNNUE || nnueNetwork == nil {
+		brd.acc = nil
+		return
+	}
+	brd.acc = brd.worker.accumulator(0, nnueNetwork)
+	brd.acc.Refresh(brd)
+}
@@ -0,0 +1,136 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+// A small network with random weights, used only to verify the NNUE implementation.
+const TINY_NETWORK = "test_suites/tiny.nnue"
+
+var nnueTestPositions = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+}
+
+func TestNNUEIncrementalUpdates(t *testing.T) {
+	net, err := LoadNetwork(TINY_NETWORK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	htable := new(HistoryTable)
+	stk := make(Stack, MAX_STACK, MAX_STACK)
+	for _, fen := range nnueTestPositions {
+		brd := ParseFENString(fen)
+		brd.acc = NewAccumulator(net)
+		brd.acc.Refresh(brd)
+		checkAccumulator(t, brd, htable, stk, 3, 0)
+	}
+}
+
+// Even a network with extreme weights must not produce scores in the checkmate range.
+func TestNNUEScoreRange(t *testing.T) {
+	net := &Network{
+		featureWeights: make([]int16, NNUE_INPUTS),
+		featureBiases:  []int16{NNUE_QA},
+		outputWeights:  []int16{32767, 32767},
+		hiddenSize:     1,
+	}
+	acc := NewAccumulator(net)
+	acc.Refresh(StartPos())
+	if score := acc.Evaluate(WHITE); score != MIN_MATE-1 {
+		t.Errorf("expected score to be clamped to %d, got %d", MIN_MATE-1, score)
+	}
+	net.outputWeights = []int16{-32768, -32768}
+	if score := acc.Evaluate(WHITE); score != -(MIN_MATE - 1) {
+		t.Errorf("expected score to be clamped to %d, got %d", -(MIN_MATE - 1), score)
+	}
+}
+
+// Searches with NNUE evaluation reuse each worker's accumulator storage rather than allocating
+// new accumulators, including for boards copied from split points by other workers.
+func TestNNUESearch(t *testing.T) {
+	net, err := LoadNetwork(TINY_NETWORK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nnueNetwork, useNNUE = net, true
+	defer func() { nnueNetwork, useNNUE = nil, false }()
+	setupLoadBalancer(4)
+	defer setupLoadBalancer(runtime.NumCPU())
+	var rootAcc *Accumulator
+	for i := 0; i < 2; i++ {
+		resetMainTt()
+		brd := StartPos()
+		gt := NewGameTimer(0, brd.c)
+		gt.SetMoveTime(MAX_TIME)
+		s := NewSearch(SearchParams{7, false, false}, gt, nil, nil, nil)
+		s.Start(brd)
+		if !containsMove(brd.LegalMoves(), s.bestMove) {
+			t.Fatalf("expected a legal best move, got %s", s.bestMove.ToUCI())
+		}
+		if !accumulatorMatches(brd) {
+			t.Fatal("root accumulator out of sync after search")
+		}
+		if i > 0 && brd.acc != rootAcc {
+			t.Error("expected the root accumulator to be reused between searches")
+		}
+		rootAcc = brd.acc
+	}
+}
+
+func TestNNUERejectsMalformedFiles(t *testing.T) {
+	if _, err := ParseNetwork(make([]byte, 1000)); err == nil {
+		t.Error("expected an error for a truncated network file")
+	}
+	data := make([]byte, 2*((NNUE_INPUTS+3)*4+1)+64)
+	if _, err := ParseNetwork(data); err == nil {
+		t.Error("expected an error for a network file with excess data")
+	}
+	if net, err := ParseNetwork(data[:len(data)-2]); err != nil || net.hiddenSize != 4 {
+		t.Errorf("expected a network with 4 hidden neurons, got error %v", err)
+	}
+}
+
+// checkAccumulator walks the move tree to the given depth, verifying that the incrementally
+// updated accumulator matches a freshly computed one after each make and unmake.
+func checkAccumulator(t *testing.T, brd *Board, htable *HistoryTable, stk Stack, depth, ply int) {
+	if !accumulatorMatches(brd) {
+		t.Fatalf("accumulator out of sync at ply %d", ply)
+	}
+	if depth == 0 {
+		return
+	}
+	thisStk := stk[ply]
+	memento := brd.NewMemento()
+	recycler := loadBalancer.RootWorker().recycler
+	generator := NewMoveSelector(brd, &thisStk, htable, brd.InCheck(), NO_MOVE)
+	for m, _ := generator.Next(recycler, SP_NONE); m != NO_MOVE; m, _ = generator.Next(recycler, SP_NONE) {
+		makeMove(brd, m)
+		checkAccumulator(t, brd, htable, stk, depth-1, ply+1)
+		unmakeMove(brd, m, memento)
+		if !accumulatorMatches(brd) {
+			t.Fatalf("accumulator out of sync after unmaking %s", m.ToUCI())
+		}
+	}
+}
+
+func accumulatorMatches(brd *Board) bool {
+	fresh := NewAccumulator(brd.acc.net)
+	fresh.Refresh(brd)
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		for i, v := range fresh.values[c] {
+			if brd.acc.values[c][i] != v {
+				return false
+			}
+		}
+	}
+	return brd.acc.Evaluate(brd.c) == fresh.Evaluate(brd.c)
+}
@@ -114,12 +114,11 @@ func ToSAN(brd *Board, m Move) string { // convert move to Standard Algebraic No
 		return PawnSAN(brd, m, san)
 	}
 
-	if piece == KING {
-		if to-from == 2 { // kingside castling
+	if m.IsCastle() {
+		if m.CastleSide() == KINGSIDE {
 			return "O-O"
-		} else if to-from == -2 { // queenside castling
-			return "O-O-O"
 		}
+		return "O-O-O"
 	}
 
 	if m.IsCapture() {
@@ -190,6 +189,73 @@ func GivesCheck(brd *Board, m Move) bool {
 	return inCheck
 }
 
+var (
+	fenCastleRights = regexp.MustCompile(`^(-|[KQA-Hkqa-h]{1,4})$`)
+	fenEnpTargets   = [2]*regexp.Regexp{regexp.MustCompile(`^(-|[a-h]3)$`), regexp.MustCompile(`^(-|[a-h]6)$`)}
+)
+
+// ParseFENFields parses a position received from the GUI, returning an error if the FEN is
+// malformed or describes an illegal position. The placement, side to move and castling rights
+// fields are required.
+func ParseFENFields(fenFields []string) (*Board, error) {
+	if len(fenFields) < 3 {
+		return nil, fmt.Errorf("incomplete FEN %q", strings.Join(fenFields, " "))
+	}
+	if err := validatePlacement(fenFields[0]); err != nil {
+		return nil, err
+	}
+	if fenFields[1] != "w" && fenFields[1] != "b" {
+		return nil, fmt.Errorf("invalid side to move %q", fenFields[1])
+	}
+	if !fenCastleRights.MatchString(fenFields[2]) {
+		return nil, fmt.Errorf("invalid castling rights %q", fenFields[2])
+	}
+	if len(fenFields) > 3 && !fenEnpTargets[ParseSide(fenFields[1])].MatchString(fenFields[3]) {
+		return nil, fmt.Errorf("invalid en passant target %q", fenFields[3])
+	}
+	brd := ParseFENSlice(fenFields)
+	for _, c := range [2]uint8{BLACK, WHITE} {
+		if count := popCount(brd.pieces[c][KING]); count != 1 {
+			return nil, fmt.Errorf("expected one %s king, found %d", [2]string{"black", "white"}[c], count)
+		}
+	}
+	if (brd.pieces[WHITE][PAWN]|brd.pieces[BLACK][PAWN])&(rowMasks[0]|rowMasks[7]) > 0 {
+		return nil, fmt.Errorf("pawns on the first or last rank")
+	}
+	if brd.enpTarget != SQ_INVALID && brd.pieces[brd.Enemy()][PAWN]&sqMaskOn[brd.enpTarget] == 0 {
+		return nil, fmt.Errorf("invalid en passant target %q: no pawn to capture", fenFields[3])
+	}
+	if isAttackedBy(brd, brd.AllOccupied(), brd.KingSq(brd.Enemy()), brd.c, brd.Enemy()) {
+		return nil, fmt.Errorf("side to move can capture the enemy king")
+	}
+	return brd, nil
+}
+
+// validatePlacement checks that the placement field gives 8 ranks of 8 squares each.
+func validatePlacement(str string) error {
+	ranks := strings.Split(str, "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("expected 8 ranks in FEN placement %q, found %d", str, len(ranks))
+	}
+	for i, rank := range ranks {
+		squares := 0
+		for _, r := range rank {
+			if r >= '1' && r <= '8' {
+				squares += int(r - '0')
+			} else if _, ok := fenPieceChars[string(r)]; ok {
+				squares++
+			} else {
+				return fmt.Errorf("invalid piece %q in FEN placement %q", r, str)
+			}
+		}
+		if squares != 8 {
+			return fmt.Errorf("expected 8 squares on rank %d of FEN placement %q, found %d", 8-i,
+				str, squares)
+		}
+	}
+	return nil
+}
+
 func ParseFENSlice(fenFields []string) *Board {
 	brd := EmptyBoard()
 
@@ -225,6 +291,65 @@ func ParseFENString(str string) *Board {
 	return brd
 }
 
+var fenChars = [2][8]string{
+	{"p", "n", "b", "r", "q", "k"},
+	{"P", "N", "B", "R", "Q", "K"},
+}
+
+// ToFEN returns the FEN string for brd. Since the board does not keep track of the fullmove
+// number, it is always given as 1.
+func (brd *Board) ToFEN() string {
+	var fen []string
+	for r := 7; r >= 0; r-- {
+		rowStr, empty := "", 0
+		for col := 0; col < 8; col++ {
+			sq := Square(r, col)
+			if brd.squares[sq] == EMPTY {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				rowStr += strconv.Itoa(empty)
+				empty = 0
+			}
+			c := WHITE
+			if brd.occupied[BLACK]&sqMaskOn[sq] > 0 {
+				c = BLACK
+			}
+			rowStr += fenChars[c][brd.squares[sq]]
+		}
+		if empty > 0 {
+			rowStr += strconv.Itoa(empty)
+		}
+		fen = append(fen, rowStr)
+	}
+	side := "w"
+	if brd.c == BLACK {
+		side = "b"
+	}
+	castle := ""
+	for _, c := range [2]uint8{WHITE, BLACK} {
+		for _, side := range [2]int{KINGSIDE, QUEENSIDE} {
+			if brd.castle&castleFlags[c][side] > 0 {
+				castle += castleRightsString(brd, c, side)
+			}
+		}
+	}
+	if castle == "" {
+		castle = "-"
+	}
+	enp := "-"
+	if brd.enpTarget != SQ_INVALID {
+		if brd.c == WHITE { // the square behind the pawn that just advanced.
+			enp = SquareString(int(brd.enpTarget) + 8)
+		} else {
+			enp = SquareString(int(brd.enpTarget) - 8)
+		}
+	}
+	return fmt.Sprintf("%s %s %s %s %d 1", strings.Join(fen, "/"), side, castle, enp,
+		brd.halfmoveClock)
+}
+
 var fenPieceChars = map[string]int{
 	"p": 0,
 	"n": 1,
@@ -276,35 +401,86 @@ func ParseSide(str string) uint8 {
 	}
 }
 
+// Castling rights may be given in standard FEN (KQkq), Shredder-FEN (the files of the castling
+// rooks, e.g. HAha), or X-FEN, in which KQkq refers to the outermost rook on that side of the king
+// and file letters are used only when castling with an inner rook. Rights that don't correspond to
+// a rook on the back rank are ignored.
 func ParseCastleRights(brd *Board, str string) uint8 {
 	var castle uint8
-	if str != "-" {
-		match, _ := regexp.MatchString("K", str)
-		if match {
-			castle |= C_WK
+	if str == "-" {
+		return castle
+	}
+	for _, r := range str {
+		c := uint8(WHITE)
+		if r >= 'a' && r <= 'z' {
+			c, r = BLACK, r-'a'+'A'
 		}
-		match, _ = regexp.MatchString("Q", str)
-		if match {
-			castle |= C_WQ
+		if brd.pieces[c][KING]&rowMasks[backRow[c]] == 0 {
+			continue
 		}
-		match, _ = regexp.MatchString("k", str)
-		if match {
-			castle |= C_BK
+		kingSq, rookSq := brd.KingSq(c), SQ_INVALID
+		switch {
+		case r == 'K':
+			rookSq = outermostRook(brd, c, KINGSIDE)
+		case r == 'Q':
+			rookSq = outermostRook(brd, c, QUEENSIDE)
+		case r >= 'A' && r <= 'H':
+			if sq := Square(row(kingSq), int(r-'A')); brd.pieces[c][ROOK]&sqMaskOn[sq] > 0 {
+				rookSq = sq
+			}
+		}
+		if rookSq == SQ_INVALID {
+			continue
 		}
-		match, _ = regexp.MatchString("q", str)
-		if match {
-			castle |= C_BQ
+		side := QUEENSIDE
+		if rookSq > kingSq {
+			side = KINGSIDE
 		}
+		castle |= castleFlags[c][side]
+		brd.castleRooks[c][side] = uint8(rookSq)
 	}
 	return castle
 }
 
+// outermostRook returns the square of the rook nearest the corner on the given side of the king,
+// or SQ_INVALID if there are no rooks on that side of the king.
+func outermostRook(brd *Board, c uint8, side int) int {
+	kingSq := brd.KingSq(c)
+	rooks := brd.pieces[c][ROOK] & rowMasks[row(kingSq)]
+	if side == KINGSIDE {
+		if rooks &= ^(sqMaskOn[kingSq]<<1 - 1); rooks > 0 {
+			return msb(rooks)
+		}
+	} else if rooks &= sqMaskOn[kingSq] - 1; rooks > 0 {
+		return lsb(rooks)
+	}
+	return SQ_INVALID
+}
+
+// castleRightsString gives the X-FEN representation of a single castling right.
+func castleRightsString(brd *Board, c uint8, side int) string {
+	rookSq := int(brd.castleRooks[c][side])
+	str := [2]string{"Q", "K"}[side]
+	if outermostRook(brd, c, side) != rookSq {
+		str = strings.ToUpper(columnNames[column(rookSq)])
+	}
+	if c == BLACK {
+		str = strings.ToLower(str)
+	}
+	return str
+}
+
+// FEN gives the square behind the pawn that just advanced two squares, while the board stores the
+// location of the pawn itself.
 func ParseEnpTarget(str string) uint8 {
 	if str == "-" {
 		return SQ_INVALID
-	} else {
-		return uint8(ParseSquare(str))
 	}
+	sq := ParseSquare(str)
+	if row(sq) == 2 {
+		return uint8(sq + 8)
+	}
+	return uint8(sq - 8)
 }
 
 func ParseHalfmoveClock(str string) uint8 {
@@ -312,7 +488,7 @@ func ParseHalfmoveClock(str string) uint8 {
 	if nonNumeric {
 		return 0
 	} else {
-		halmoveClock, _ := strconv.ParseInt(str, 10, 8)
+		halmoveClock, _ := strconv.ParseUint(str, 10, 8)
 		return uint8(halmoveClock)
 	}
 }
@@ -326,6 +502,19 @@ func ParseMove(brd *Board, str string) Move {
 	from := ParseSquare(str[:2])
 	to := ParseSquare(str[2:4])
 	piece := brd.TypeAt(from)
+	if piece == KING {
+		// castles may be given as king-takes-rook, or as a two-square king move.
+		c := brd.c
+		for side := QUEENSIDE; side <= KINGSIDE; side++ {
+			if brd.castle&castleFlags[c][side] == 0 || brd.pieces[c][KING]&sqMaskOn[from] == 0 {
+				continue
+			}
+			kingTo, _ := castleDestinations(from, side)
+			if to == int(brd.castleRooks[c][side]) || (abs(to-from) == 2 && to == kingTo) {
+				return NewCastle(from, int(brd.castleRooks[c][side]))
+			}
+		}
+	}
 	capturedPiece := brd.TypeAt(to)
 	if piece == PAWN && capturedPiece == EMPTY { // check for en-passant capture
 		if abs(to-from) == 9 || abs(to-from) == 7 {
@@ -341,6 +530,22 @@ func ParseMove(brd *Board, str string) Move {
 	return NewMove(from, to, piece, capturedPiece, promotedTo)
 }
 
+// ParseLegalMove parses a move in UCI notation, returning an error unless the move is legal for
+// brd. Moves received from the GUI are checked this way, since ParseMove infers the moving and
+// captured pieces from the board and would happily construct an illegal move.
+func ParseLegalMove(brd *Board, str string) (Move, error) {
+	if !IsMove(str) {
+		return NO_MOVE, fmt.Errorf("invalid move %q", str)
+	}
+	m := ParseMove(brd, str)
+	for _, legalMove := range brd.LegalMoves() {
+		if m == legalMove {
+			return m, nil
+		}
+	}
+	return NO_MOVE, fmt.Errorf("illegal move %s in position %s", str, brd.ToFEN())
+}
+
 // A1 through H8.  test with Regexp.
 
 var columnChars = map[string]int{
@@ -358,7 +563,7 @@ var columnNames = [8]string{"a", "b", "c", "d", "e", "f", "g", "h"}
 
 // create regular expression to match valid move string.
 func IsMove(str string) bool {
-	match, _ := regexp.MatchString("[a-h][1-8][a-h][1-8][nbrq]?", str)
+	match, _ := regexp.MatchString("^[a-h][1-8][a-h][1-8][nbrq]?$", str)
 	return match
 }
 
@@ -7,6 +7,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -20,3 +21,61 @@ func TestEPDParsing(t *testing.T) {
 		epd.Print()
 	}
 }
+
+// The en-passant target given in a FEN is the square behind the pawn that just advanced, while the
+// board keeps the square of the pawn itself.
+func TestEnpTargetRoundTrip(t *testing.T) {
+	tests := []struct{ fen, pawn string }{
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", "e4"},
+		{"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 1", "d5"},
+		{"8/8/8/2k5/3Pp3/8/8/4K3 b - d3 0 1", "d4"},
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		if int(brd.enpTarget) != ParseSquare(test.pawn) {
+			t.Errorf("%s: expected en-passant pawn on %s, got %s", test.fen, test.pawn,
+				SquareString(int(brd.enpTarget)))
+		}
+		if fen := brd.ToFEN(); fen != test.fen {
+			t.Errorf("expected %s, got %s", test.fen, fen)
+		}
+	}
+}
+
+func TestCastleRightsParsing(t *testing.T) {
+	tests := []struct{ fen, castle string }{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1", "KQkq"},
+		{"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", "KQkq"},
+		{"rr2k3/8/8/8/8/8/8/1R2K2R w BHb - 0 1", "KQb"}, // X-FEN uses file letters for inner rooks.
+		{"r3k2r/8/8/8/8/8/8/4K3 w KQkq - 0 1", "kq"},    // rights without a rook are ignored.
+	}
+	for _, test := range tests {
+		fields := strings.Split(ParseFENString(test.fen).ToFEN(), " ")
+		if fields[2] != test.castle {
+			t.Errorf("expected castling rights %s for %s, got %s", test.castle, test.fen, fields[2])
+		}
+	}
+}
+
+func TestParseLegalMove(t *testing.T) {
+	tests := []struct {
+		fen, move string
+		legal     bool
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", true},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e5", false},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e7e5", false}, // wrong side.
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4x", false},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", true},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w Qkq - 0 1", "e1g1", false},
+		{"8/8/8/2k5/3Pp3/8/8/4K3 b - d3 0 1", "e4d3", true}, // e.p. capture evading check.
+		{"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7e8n", true},
+		{"4k3/8/8/8/8/8/4R3/4K3 b - - 0 1", "e8e7", false},
+	}
+	for _, test := range tests {
+		_, err := ParseLegalMove(ParseFENString(test.fen), test.move)
+		if (err == nil) != test.legal {
+			t.Errorf("%s in %s: expected legal=%t, got error %v", test.move, test.fen, test.legal, err)
+		}
+	}
+}
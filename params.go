@@ -0,0 +1,214 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Evaluation parameters can be read from and written to a plain-text parameter file. Each line
+// holds the name of a parameter table followed by its values, for example:
+//
+//   materialScores 100 100 320 320 333 333 510 510 880 880
+//
+// Each weight is stored as a midgame value followed by an endgame value. Tables for black and
+// white are stored from black's point of view; the white tables are derived from them by
+// setupEval(). Lines beginning with '#' are ignored.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EvalParam exposes a single table of evaluation weights to the tuner and to parameter files.
+type EvalParam struct {
+	name string
+	size int
+	get  func(i int) int
+	set  func(i, value int)
+}
+
+// scoreParam exposes the midgame and endgame components of each Score in table as separate
+// weights, with even indices referring to midgame values and odd indices to endgame values.
+func scoreParam(name string, table []Score) EvalParam {
+	return EvalParam{
+		name: name,
+		size: 2 * len(table),
+		get: func(i int) int {
+			if i%2 == MIDGAME {
+				return table[i/2].MG()
+			}
+			return table[i/2].EG()
+		},
+		set: func(i, value int) {
+			if i%2 == MIDGAME {
+				table[i/2] = S(value, table[i/2].EG())
+			} else {
+				table[i/2] = S(table[i/2].MG(), value)
+			}
+		},
+	}
+}
+
+func scalarParam(name string, value *Score) EvalParam {
+	return EvalParam{
+		name: name,
+		size: 2,
+		get: func(i int) int {
+			if i == MIDGAME {
+				return value.MG()
+			}
+			return value.EG()
+		},
+		set: func(i, v int) {
+			if i == MIDGAME {
+				*value = S(v, value.EG())
+			} else {
+				*value = S(value.MG(), v)
+			}
+		},
+	}
+}
+
+// imbalanceParam exposes the lower triangle of a quadratic imbalance table, row by row.
+func imbalanceParam(name string, table *[6][6]int) EvalParam {
+	var rows, cols []int
+	for i := 0; i < 6; i++ {
+		for j := 0; j <= i; j++ {
+			rows, cols = append(rows, i), append(cols, j)
+		}
+	}
+	return EvalParam{
+		name: name,
+		size: len(rows),
+		get:  func(i int) int { return table[rows[i]][cols[i]] },
+		set:  func(i, value int) { table[rows[i]][cols[i]] = value },
+	}
+}
+
+// evalParams lists every tunable evaluation table. After changing any of these values,
+// setupEval() must be called to update the derived tables.
+func evalParams() []EvalParam {
+	return []EvalParam{
+		scoreParam("materialScores", materialScores[PAWN:KING]),
+		scoreParam("pawnPst", mainPst[BLACK][PAWN][:]),
+		scoreParam("knightPst", mainPst[BLACK][KNIGHT][:]),
+		scoreParam("bishopPst", mainPst[BLACK][BISHOP][:]),
+		scoreParam("rookPst", mainPst[BLACK][ROOK][:]),
+		scoreParam("queenPst", mainPst[BLACK][QUEEN][:]),
+		scoreParam("kingPst", kingPst[BLACK][:]),
+		scoreParam("knightPawns", knightPawns[:9]),
+		scoreParam("rookPawns", rookPawns[:9]),
+		scalarParam("bishopPairBonus", &bishopPairBonus),
+		scoreParam("bishopPairPawns", bishopPairPawns[:9]),
+		imbalanceParam("imbalanceOurs", &imbalanceOurs),
+		imbalanceParam("imbalanceTheirs", &imbalanceTheirs),
+		scoreParam("knightMobility", knightMobility[:9]),
+		scoreParam("bishopMobility", bishopMobility[:14]),
+		scoreParam("rookMobility", rookMobility[:15]),
+		scoreParam("queenMobility", queenMobility[:28]),
+		scoreParam("queenTropismBonus", queenTropismBonus[:]),
+		scoreParam("pawnShieldBonus", pawnShieldBonus[:]),
+		scoreParam("kingThreatBonus", kingThreatBonus[:]),
+		scoreParam("passedPawnBonus", passedPawnBonus[BLACK][:]),
+		scoreParam("tarraschBonus", tarraschBonus[BLACK][:]),
+		scoreParam("defenseBonus", defenseBonus[BLACK][:]),
+		scoreParam("duoBonus", duoBonus[BLACK][:]),
+		scalarParam("passedEnemyKingBonus", &passedEnemyKingBonus),
+		scalarParam("passedOwnKingPenalty", &passedOwnKingPenalty),
+		scalarParam("passedFreePathBonus", &passedFreePathBonus),
+		scalarParam("passedSafePathBonus", &passedSafePathBonus),
+		scalarParam("passedBlockadePenalty", &passedBlockadePenalty),
+		scalarParam("passedSupportedBonus", &passedSupportedBonus),
+		scalarParam("passedConnectedBonus", &passedConnectedBonus),
+		scalarParam("unstoppablePasserBonus", &unstoppablePasserBonus),
+		scalarParam("doubledPenalty", &doubledPenalty),
+		scalarParam("isolatedPenalty", &isolatedPenalty),
+		scalarParam("backwardPenalty", &backwardPenalty),
+		scalarParam("spaceBonus", &spaceBonus),
+		scalarParam("rookOpenFileBonus", &rookOpenFileBonus),
+		scalarParam("rookSemiOpenFileBonus", &rookSemiOpenFileBonus),
+		scalarParam("rookSeventhBonus", &rookSeventhBonus),
+		scalarParam("knightOutpostBonus", &knightOutpostBonus),
+		scalarParam("bishopOutpostBonus", &bishopOutpostBonus),
+		scalarParam("pawnThreatBonus", &pawnThreatBonus),
+		scoreParam("minorThreatBonus", minorThreatBonus[PAWN:KING]),
+		scoreParam("rookThreatBonus", rookThreatBonus[PAWN:KING]),
+		scalarParam("hangingBonus", &hangingBonus),
+		scalarParam("trappedRookPenalty", &trappedRookPenalty),
+		scalarParam("trappedBishopPenalty", &trappedBishopPenalty),
+	}
+}
+
+func loadEvalParams(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	params := make(map[string]EvalParam)
+	for _, p := range evalParams() {
+		params[p.name] = p
+	}
+
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		p, ok := params[fields[0]]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown parameter %s", path, lineNumber, fields[0])
+		}
+		if len(fields)-1 != p.size {
+			return fmt.Errorf("%s:%d: expected %d values for %s, got %d", path, lineNumber, p.size,
+				p.name, len(fields)-1)
+		}
+		for i, str := range fields[1:] {
+			value, err := strconv.Atoi(str)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid value %q for %s", path, lineNumber, str, p.name)
+			}
+			p.set(i, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	setupEval()
+	return nil
+}
+
+func saveEvalParams(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "# GopherCheck %s evaluation parameters\n", version)
+	for _, p := range evalParams() {
+		fmt.Fprint(w, p.name)
+		for i := 0; i < p.size; i++ {
+			fmt.Fprintf(w, " %d", p.get(i))
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// paramCount returns the total number of individual weights exposed by params.
+func paramCount(params []EvalParam) int {
+	count := 0
+	for _, p := range params {
+		count += p.size
+	}
+	return count
+}
@@ -17,7 +17,10 @@ type PawnEntry struct {
 	rightAttacks [2]BB
 	allAttacks   [2]BB
 	passedPawns  [2]BB
-	value        [2]int
+	outposts     [2]BB // squares supported by a friendly pawn that enemy pawns can never attack.
+	semiOpen     [2]BB // files containing no friendly pawns.
+	openFiles    BB    // files containing no pawns of either side.
+	value        [2]Score
 	key          uint32
 	count        [2]uint8
 }
@@ -0,0 +1,139 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Perft counts the leaf nodes of the legal move tree to a given depth. Since the counts for
+// many positions are well known, this is the standard way to verify move generation. Divide
+// gives the counts below each root move, so that a discrepancy with another engine can be
+// followed down the tree to the offending move.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// PerftTT caches subtree counts so that transpositions are only counted once.
+type PerftTT struct {
+	buckets []Bucket
+	mask    uint64
+}
+
+// NewPerftTT allocates a perft hash table of at most the given size in megabytes.
+func NewPerftTT(size int) *PerftTT {
+	count := uint64(1)
+	for count*2*16 <= uint64(size)<<20 { // each bucket is 16 bytes.
+		count *= 2
+	}
+	return &PerftTT{buckets: make([]Bucket, count), mask: count - 1}
+}
+
+// Entries store the remaining depth in the lower 8 bits of the data, and the node count in the
+// remaining bits. Entries are verified via the XOR of key and data, as in the main TT.
+func (tt *PerftTT) Probe(hashKey uint64, depth int) (int, bool) {
+	data, key := tt.buckets[hashKey&tt.mask].Load()
+	if uint64(data^key) == hashKey && data&255 == BucketData(depth) {
+		return int(data >> 8), true
+	}
+	return 0, false
+}
+
+func (tt *PerftTT) Store(hashKey uint64, depth, nodes int) {
+	tt.buckets[hashKey&tt.mask].Store(BucketData(nodes<<8|depth), hashKey)
+}
+
+type DivideResult struct {
+	move  Move
+	nodes int
+}
+
+// Perft returns the number of leaf nodes at the given depth, splitting the root moves among
+// the given number of goroutines. tt may be nil.
+func Perft(brd *Board, depth, threads int, tt *PerftTT) int {
+	if depth == 0 {
+		return 1
+	}
+	var sum int
+	for _, result := range Divide(brd, depth, threads, tt) {
+		sum += result.nodes
+	}
+	return sum
+}
+
+// Divide returns the number of leaf nodes at the given depth below each legal root move.
+func Divide(brd *Board, depth, threads int, tt *PerftTT) []DivideResult {
+	moves := brd.LegalMoves()
+	results := make([]DivideResult, len(moves))
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for i := 0; i < max(threads, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pw := newPerftWorker(tt)
+			for j := int(atomic.AddInt64(&next, 1)); j < len(moves); j = int(atomic.AddInt64(&next, 1)) {
+				cpy := brd.Copy()
+				makeMove(cpy, moves[j])
+				results[j] = DivideResult{moves[j], pw.perft(cpy, depth-1, 1)}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Each goroutine gets its own move list recycler, history table and stack.
+type perftWorker struct {
+	htable   HistoryTable
+	stk      Stack
+	recycler *Recycler
+	tt       *PerftTT
+}
+
+func newPerftWorker(tt *PerftTT) *perftWorker {
+	return &perftWorker{
+		stk:      make(Stack, MAX_STACK, MAX_STACK),
+		recycler: NewRecycler(512),
+		tt:       tt,
+	}
+}
+
+func (pw *perftWorker) perft(brd *Board, depth, ply int) int {
+	if depth == 0 {
+		return 1
+	}
+	if pw.tt != nil && depth > 1 {
+		if nodes, ok := pw.tt.Probe(brd.hashKey, depth); ok {
+			return nodes
+		}
+	}
+	sum := 0
+	memento := brd.NewMemento()
+	thisStk := pw.stk[ply]
+	generator := NewMoveSelector(brd, &thisStk, &pw.htable, brd.InCheck(), NO_MOVE)
+	for m, _ := generator.Next(pw.recycler, SP_NONE); m != NO_MOVE; m, _ = generator.Next(pw.recycler, SP_NONE) {
+		sum += pw.perftMove(brd, m, memento, depth, ply)
+		if m.IsPromotion() && m.PromotedTo() == QUEEN {
+			for _, pc := range underpromotions {
+				sum += pw.perftMove(brd, underpromotion(m, pc), memento, depth, ply)
+			}
+		}
+	}
+	generator.Recycle(pw.recycler)
+	if pw.tt != nil && depth > 1 {
+		pw.tt.Store(brd.hashKey, depth, sum)
+	}
+	return sum
+}
+
+func (pw *perftWorker) perftMove(brd *Board, m Move, memento *BoardMemento, depth, ply int) int {
+	if depth == 1 {
+		return 1 // leaf moves needn't be made.
+	}
+	makeMove(brd, m)
+	nodes := pw.perft(brd, depth-1, ply+1)
+	unmakeMove(brd, m, memento)
+	return nodes
+}
@@ -7,13 +7,26 @@ package main
 
 // "fmt"
 
-func (stk Stack) IsRepetition(ply int, halfmoveClock uint8) bool {
+// IsRepetition returns true if the position at ply has occurred twice before. Positions before
+// the root are found in history, which holds the hash key of each position in the game up to and
+// including the root. Positions before the last irreversible move can't repeat the current one.
+func (stk Stack) IsRepetition(ply int, halfmoveClock uint8, history []uint64) bool {
 	hashKey := stk[ply].hashKey
 	if halfmoveClock < 4 {
 		return false
 	}
-	for repetitionCount := 0; ply >= 2; ply -= 2 {
-		if stk[ply-2].hashKey == hashKey {
+	root := len(history) - 1
+	repetitionCount := 0
+	for i := ply - 2; i >= ply-int(halfmoveClock); i -= 2 {
+		var key uint64
+		if i >= 0 {
+			key = stk[i].hashKey
+		} else if root+i >= 0 {
+			key = history[root+i]
+		} else {
+			break
+		}
+		if key == hashKey {
 			repetitionCount += 1
 			if repetitionCount == 2 {
 				return true
@@ -0,0 +1,206 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Root move ordering. The root node keeps its own list of legal moves for the duration of the
+// search, along with the score and subtree size of each move from the latest iteration. After
+// each iteration the best move is searched first, followed by the other moves in order of the
+// number of nodes needed to refute them: a move with a large subtree was hard to refute, and is
+// more likely to become the best move at the next depth.
+//
+// When several principal variations are requested (MultiPV), each line is searched in turn with
+// the moves of the lines before it excluded, and the best move of each line is kept in order of
+// score at the front of the list. The list also restricts the search to any moves given via
+// "go searchmoves", and provides the move being searched for "info currmove" reports.
+
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	CURRMOVE_MIN_TIME = time.Second // only report the root move being searched after this long.
+	MAX_MULTIPV       = 64
+)
+
+type RootMove struct {
+	move      Move
+	score     int // score from the latest search of this move, or -INF if it failed low.
+	prevScore int // score at the end of the previous iteration.
+	nodes     int // nodes searched below this move during the current iteration.
+	pv        *PV
+	extend    bool // winning promotions are extended.
+}
+
+type RootMoves []RootMove
+
+// NewRootMoves lists the legal moves at the root in the order given by the move selector, hash
+// move first. Unlike the rest of the search, all promotions are listed, with the remaining
+// underpromotions following each queen promotion. If allowedMoves is not empty, only those
+// moves are listed.
+func NewRootMoves(brd *Board, stk Stack, htable *HistoryTable, allowedMoves []Move) RootMoves {
+	var score int
+	var rootMoves RootMoves
+	firstMove, _ := mainTt.probe(brd, 0, 0, -INF, INF, &score)
+	selector := NewMoveSelector(brd, &stk[0], htable, stk[0].inCheck, firstMove)
+	recycler := brd.worker.recycler
+	add := func(m Move, extend bool) {
+		if len(allowedMoves) > 0 && !containsMove(allowedMoves, m) {
+			return // restrict search to only those moves requested by the GUI.
+		}
+		for _, rm := range rootMoves {
+			if rm.move == m {
+				return // an underpromotion may already have been tried as the hash move.
+			}
+		}
+		rootMoves = append(rootMoves, RootMove{move: m, score: -INF, prevScore: -INF, extend: extend})
+	}
+	for m, stage := selector.Next(recycler, SP_NONE); m != NO_MOVE; m, stage = selector.Next(recycler, SP_NONE) {
+		add(m, stage == STAGE_WINNING && brd.MayPromote(m) && m.IsPromotion())
+		if m.IsPromotion() && m.PromotedTo() == QUEEN {
+			for _, pc := range underpromotions {
+				add(underpromotion(m, pc), false)
+			}
+		}
+	}
+	selector.Recycle(recycler)
+	return rootMoves
+}
+
+func containsMove(moves []Move, m Move) bool {
+	for _, other := range moves {
+		if m == other {
+			return true
+		}
+	}
+	return false
+}
+
+// startIteration saves the scores from the previous iteration and resets node counts.
+func (rootMoves RootMoves) startIteration() {
+	for i := range rootMoves {
+		rootMoves[i].prevScore, rootMoves[i].nodes = rootMoves[i].score, 0
+	}
+}
+
+// sortByScore orders moves by their latest score. Moves that failed low keep their relative order.
+func (rootMoves RootMoves) sortByScore() {
+	sort.SliceStable(rootMoves, func(i, j int) bool {
+		return rootMoves[i].score > rootMoves[j].score
+	})
+}
+
+// sortByNodes orders moves by the size of their subtrees during the current iteration.
+func (rootMoves RootMoves) sortByNodes() {
+	sort.SliceStable(rootMoves, func(i, j int) bool {
+		return rootMoves[i].nodes > rootMoves[j].nodes
+	})
+}
+
+// bestNodeShare gives the fraction of the nodes searched during the current iteration that were
+// spent on the best move.
+func (rootMoves RootMoves) bestNodeShare() float64 {
+	sum := 0
+	for i := range rootMoves {
+		sum += rootMoves[i].nodes
+	}
+	if sum == 0 {
+		return 0
+	}
+	return float64(rootMoves[0].nodes) / float64(sum)
+}
+
+// searchRoot searches the root moves from index pvIdx onward, and records the score and node
+// count of each move. The root node is always searched sequentially; parallel search begins at
+// the children of the root.
+func (s *Search) searchRoot(brd *Board, stk Stack, pvIdx, alpha, beta, depth int) (int, int) {
+	var score, total, subtotal int
+	var quiets [MAX_QUIETS]Move
+	quietCount := 0
+	best, bestMove, oldAlpha := -INF, NO_MOVE, alpha
+	sum := 1
+
+	thisStk := &stk[0]
+	thisStk.hashKey = brd.hashKey
+	checked := thisStk.inCheck // Don't extend on the first check in the current variation.
+	memento := brd.NewMemento()
+
+	rootMoves := s.rootMoves[pvIdx:]
+	for i := range rootMoves {
+		rootMoves[i].score = -INF
+	}
+
+	for i := range rootMoves {
+		rm := &rootMoves[i]
+		m := rm.move
+		if s.uci != nil && s.gt.Elapsed() >= CURRMOVE_MIN_TIME {
+			s.uci.CurrMove(depth, m, pvIdx+i+1)
+		}
+
+		rDepth := depth
+		if rm.extend {
+			rDepth = depth + 1
+		}
+		childType := s.determineChildType(Y_PV, i)
+
+		makeMove(brd, m)
+		stk[1].inCheck = brd.InCheck()
+		stk[1].prevMoves = [2]Move{m, thisStk.prevMoves[0]}
+		stk[1].pv = nil // only PV children set their PV, so don't keep one from another move.
+
+		if alpha > oldAlpha {
+			score, total = s.ybw(brd, stk, (-alpha)-1, -alpha, rDepth-1, 1, childType, SP_NONE, checked)
+			score = -score
+			if score > alpha { // re-search with full-window on fail high
+				score, subtotal = s.ybw(brd, stk, -beta, -alpha, rDepth-1, 1, Y_PV, SP_NONE, checked)
+				score = -score
+				total += subtotal
+			}
+		} else {
+			score, total = s.ybw(brd, stk, -beta, -alpha, rDepth-1, 1, childType, SP_NONE, checked)
+			score = -score
+		}
+
+		unmakeMove(brd, m, memento)
+		sum += total
+		rm.nodes += total
+
+		select {
+		case <-s.cancel:
+			return NO_SCORE, sum
+		default:
+		}
+
+		if m.IsQuiet() && quietCount < MAX_QUIETS {
+			quiets[quietCount] = m
+			quietCount++
+		}
+
+		if score > best {
+			if score > alpha {
+				rm.score, rm.pv = score, &PV{m, score, depth, stk[1].pv}
+				if score >= beta {
+					if pvIdx == 0 { // later lines exclude the best move, so aren't stored.
+						storeCutoff(thisStk, s.htable, m, brd.c, depth, quiets[:quietCount])
+						s.store(brd, thisStk, m, depth, LOWER_BOUND, score)
+					}
+					return score, sum
+				}
+				alpha = score
+			}
+			bestMove, best = m, score
+		}
+	}
+
+	if pvIdx == 0 {
+		if alpha > oldAlpha {
+			s.store(brd, thisStk, bestMove, depth, EXACT, best)
+		} else {
+			s.store(brd, thisStk, bestMove, depth, UPPER_BOUND, best)
+		}
+	}
+	return best, sum
+}
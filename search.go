@@ -8,17 +8,8 @@ package main
 import (
 	"fmt"
 	"sync"
-)
-
-const ( // TODO: expose these as options via UCI interface.
-	MIN_SPLIT       = 2  // Do not begin parallel search below this depth.
-	F_PRUNE_MAX     = 2  // Do not use futility pruning when above this depth.
-	LMR_MIN         = 2  // Do not use late move reductions below this depth.
-	IID_MIN         = 4  // Do not use internal iterative deepening below this depth.
-	NULL_MOVE_MIN   = 3  // Do not use null-move pruning below this depth.
-	MIN_CHECK_DEPTH = -2 // During Q-Search, consider all evasions when in check at or above this depth.
-
-	DRAW_VALUE = KNIGHT_VALUE // The value to assign to a draw
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -29,8 +20,21 @@ const (
 )
 
 const (
-	MAX_DEPTH = 32 // default maximum search depth
-	COMMS_MIN = 1  // minimum depth at which to send info to GUI.
+	MAX_DEPTH     = 32          // default maximum search depth
+	COMMS_MIN     = 1           // minimum depth at which to send info to GUI.
+	INFO_INTERVAL = time.Second // how often to report progress during an iteration.
+
+	NODE_CHECK_MASK = 255 // each worker checks the node limit once every 256 nodes.
+)
+
+const (
+	SINGULAR_MIN = 7 // Do not test for singular moves below this depth.
+)
+
+const (
+	ASPIRATION_MIN   = 4   // Do not use aspiration windows below this depth.
+	ASPIRATION_DELTA = 25  // initial distance from the previous score to each side of the window.
+	ASPIRATION_MAX   = 400 // once the window has been widened beyond this, search a full window.
 )
 
 const (
@@ -39,32 +43,73 @@ const (
 	Y_PV
 )
 
-var searchId int
+// searchId identifies the current search, so that TT entries from earlier searches can be
+// replaced first. Concurrent self-play games advance it between games, so it's accessed atomically.
+var searchId int32
+
+func currentSearchId() int {
+	return int(atomic.LoadInt32(&searchId))
+}
+
+func nextSearchId() {
+	for {
+		id := atomic.LoadInt32(&searchId)
+		next := id + 1
+		if id >= 512 { // only 9 bits are available to store the id in each TT entry.
+			next = 0
+		}
+		if atomic.CompareAndSwapInt32(&searchId, id, next) {
+			return
+		}
+	}
+}
 
 type Search struct {
-	htable HistoryTable // must be listed first to ensure cache alignment for atomic w/r
+	htable *HistoryTable
 	SearchParams
 	sideToMove           uint8 // SearchParams would otherwise create padding
-	once                 sync.Once
+	once, abortOnce      sync.Once
 	allowedMoves         []Move
+	rootMoves            RootMoves
 	bestScore            [2]int
 	cancel               chan bool
 	bestMove, ponderMove Move
 	gt                   *GameTimer
 	uci                  *UCIAdapter
 	alpha, beta, nodes   int
+	contempt             int
+	drawScore            [2]int // the score of a draw for each side, given contempt for the root side.
+
+	// When set, the search runs sequentially on this worker instead of using the load balancer,
+	// allowing several searches to run concurrently (as during self-play).
+	privateWorker *Worker
+	nodeLimit     int // if > 0, the search stops once this many nodes are searched.
+	// hash keys of the positions in the game up to and including the root, for repetition detection.
+	history []uint64
+
+	seldepth  int32 // the deepest ply reached during the current iteration, including q-search.
+	completed int32 // the number of iterations completed so far.
+	nodeBase  int64 // worker node counts at the start of the search.
 }
 
 type SearchParams struct {
-	maxDepth                        int
-	verbose, ponder, restrictSearch bool
+	maxDepth        int
+	verbose, ponder bool
 }
 
 type SearchResult struct {
 	bestMove, ponderMove Move
 }
 
-func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, allowedMoves []Move) *Search {
+// NewSearch prepares a search using the history collected during earlier searches in the same
+// game, which is aged before use. If htable is nil, the search starts without any history.
+func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, htable *HistoryTable,
+	allowedMoves []Move) *Search {
+	if htable == nil {
+		htable = new(HistoryTable)
+	} else {
+		htable.Age()
+	}
 	s := &Search{
 		bestScore:    [2]int{-INF, -INF},
 		cancel:       make(chan bool),
@@ -76,6 +121,11 @@ func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, allowedMoves
 		gt:           gt,
 		SearchParams: params,
 		allowedMoves: allowedMoves,
+		contempt:     searchConfig.contempt,
+		htable:       htable,
+	}
+	if searchConfig.analyseMode {
+		s.contempt = 0 // draws are scored symmetrically when analysing.
 	}
 	gt.s = s
 	if !s.ponder {
@@ -87,11 +137,7 @@ func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, allowedMoves
 func (s *Search) sendResult() {
 	s.once.Do(func() {
 		if s.uci != nil {
-			if s.ponder {
-				s.uci.result <- s.Result() // queue result to be sent when requested by GUI.
-			} else {
-				s.uci.BestMove(s.Result()) // send result immediately
-			}
+			s.uci.result <- s.Result() // the UCI adapter decides when to send the result to the GUI.
 		}
 	})
 }
@@ -100,21 +146,9 @@ func (s *Search) Result() SearchResult {
 	return SearchResult{s.bestMove, s.ponderMove}
 }
 
+// Abort may be called by the timer and by the GUI at the same time.
 func (s *Search) Abort() {
-	select {
-	case <-s.cancel:
-	default:
-		close(s.cancel)
-	}
-}
-
-func (s *Search) moveAllowed(m Move) bool {
-	for _, permittedMove := range s.allowedMoves {
-		if m == permittedMove {
-			return true
-		}
-	}
-	return false
+	s.abortOnce.Do(func() { close(s.cancel) })
 }
 
 func (s *Search) sendInfo(str string) {
@@ -127,61 +161,210 @@ func (s *Search) sendInfo(str string) {
 
 func (s *Search) Start(brd *Board) {
 	s.sideToMove = brd.c
-	brd.worker = loadBalancer.RootWorker() // Send SPs generated by root goroutine to root worker.
+	s.drawScore[s.sideToMove], s.drawScore[s.sideToMove^1] = -s.contempt, s.contempt
+	if s.privateWorker != nil {
+		brd.worker = s.privateWorker
+	} else {
+		brd.worker = loadBalancer.RootWorker() // Send SPs generated by root goroutine to root worker.
+	}
+	brd.InitAccumulator()
 
+	s.nodeBase = s.workerNodes()
+	stopInfo := s.startPeriodicInfo()
 	s.nodes = s.iterativeDeepening(brd)
+	stopInfo()
+	if !s.bestMove.IsMove() && len(s.rootMoves) > 0 {
+		s.bestMove = s.rootMoves[0].move // stopped before the first iteration was completed.
+	}
 
-	if searchId >= 512 { // only 9 bits are available to store the id in each TT entry.
-		searchId = 0
-	} else {
-		searchId += 1
+	if s.privateWorker == nil { // concurrent private searches share the current search id.
+		nextSearchId()
 	}
 	s.gt.Stop() // s.cancel the timer to prevent it from interfering with the next search if it's not
 	// garbage collected before then.
 	s.sendResult()
-	if s.uci != nil {
-		s.uci.wg.Done()
-	}
 }
 
 func (s *Search) iterativeDeepening(brd *Board) int {
-	var guess, total, sum int
+	var score, total, sum int
 	c := brd.c
 	stk := brd.worker.stk
-	s.alpha, s.beta = -INF, INF // first iteration is always full-width.
-	inCheck := brd.InCheck()
+	stk[0].inCheck = brd.InCheck()
 
-	for d := 1; d <= s.maxDepth; d++ {
+	s.rootMoves = NewRootMoves(brd, stk, s.htable, s.allowedMoves)
+	if len(s.rootMoves) == 0 {
+		return 0 // checkmate or stalemate, or none of the requested moves are legal.
+	}
+	multiPV := min(searchConfig.multiPV, len(s.rootMoves))
+	instability := 0.0 // the number of recent changes of best move, halved after each iteration.
 
-		stk[0].inCheck = inCheck
-		guess, total = s.ybw(brd, stk, s.alpha, s.beta, d, 0, Y_PV, SP_NONE, false)
-		sum += total
+	for d := 1; d <= s.maxDepth; d++ {
+		s.rootMoves.startIteration()
+		atomic.StoreInt32(&s.seldepth, 0)
+
+		for pvIdx := 0; pvIdx < multiPV; pvIdx++ {
+			line := lineNumber(pvIdx, multiPV)
+			// Search a narrow window around the score from the previous iteration, widening it on
+			// each fail high or fail low. The first few iterations and mate scores use a full window.
+			guess := s.rootMoves[pvIdx].prevScore
+			delta := ASPIRATION_DELTA
+			s.alpha, s.beta = -INF, INF
+			if searchConfig.aspiration && d >= ASPIRATION_MIN && abs(guess) < MIN_MATE {
+				s.alpha, s.beta = max(guess-delta, -INF), min(guess+delta, INF)
+			}
+			for {
+				score, total = s.searchRoot(brd, stk, pvIdx, s.alpha, s.beta, d)
+				sum += total
+
+				select { // if the cancel signal was received mid-search, the current score is not useful.
+				case <-s.cancel:
+					return sum
+				default:
+				}
 
-		select { // if the cancel signal was received mid-search, the current guess is not useful.
-		case <-s.cancel:
-			return sum
-		default:
+				s.rootMoves[pvIdx:].sortByScore()
+				delta *= 2
+				if score <= s.alpha {
+					s.sendBound(score, d, line, "upperbound")
+					s.alpha = max(score-delta, -INF)
+				} else if score >= s.beta {
+					s.sendBound(score, d, line, "lowerbound")
+					s.beta = min(score+delta, INF)
+				} else {
+					break
+				}
+				if delta > ASPIRATION_MAX {
+					s.alpha, s.beta = -INF, INF
+				}
+			}
 		}
-
-		if stk[0].pv.m.IsMove() {
-			s.bestMove, s.bestScore[c] = stk[0].pv.m, guess
-			if stk[0].pv.next != nil {
-				s.ponderMove = stk[0].pv.next.m
+		s.rootMoves[:multiPV].sortByScore()
+		s.rootMoves[multiPV:].sortByNodes()
+
+		best := &s.rootMoves[0]
+		scoreDrop := 0
+		instability /= 2
+		if d > 1 {
+			scoreDrop = s.bestScore[c] - best.score
+			if best.move != s.bestMove {
+				instability++
 			}
-
-			stk[0].pv.SavePV(brd, d, guess) // install PV to transposition table prior to next iteration.
-
-		} else {
-			s.sendInfo("Nil PV returned to ID\n")
 		}
+		s.bestMove, s.bestScore[c] = best.move, best.score
+		if best.pv.next != nil {
+			s.ponderMove = best.pv.next.m
+		}
+		best.pv.SavePV(brd, d, best.score) // install PV to transposition table prior to next iteration.
+		atomic.StoreInt32(&s.completed, int32(d))
+
 		if d >= COMMS_MIN && (s.verbose || s.uci != nil) { // don't print info for first few plies to reduce communication traffic.
-			s.uci.Info(Info{guess, d, sum, s.gt.Elapsed(), stk})
+			for i := 0; i < multiPV; i++ {
+				rm := &s.rootMoves[i]
+				s.uci.Info(s.newInfo(rm.score, d, rm.pv, "", lineNumber(i, multiPV)))
+			}
+		}
+		if s.nodeLimit > 0 && sum >= s.nodeLimit {
+			break
+		}
+		if s.gt.SoftLimitReached(timeScale(instability, scoreDrop, s.rootMoves.bestNodeShare())) {
+			break
 		}
 	}
 
 	return sum
 }
 
+// lineNumber gives the number reported for a principal variation. Lines are only numbered when
+// several are requested.
+func lineNumber(pvIdx, multiPV int) int {
+	if multiPV > 1 {
+		return pvIdx + 1
+	}
+	return 0
+}
+
+// sendBound notifies the GUI when the root score falls outside the aspiration window.
+func (s *Search) sendBound(score, depth, line int, bound string) {
+	if depth >= COMMS_MIN && s.uci != nil {
+		s.uci.Info(s.newInfo(score, depth, nil, bound, line))
+	}
+}
+
+func (s *Search) newInfo(score, depth int, pv *PV, bound string, line int) Info {
+	return Info{
+		score:     score,
+		depth:     depth,
+		selDepth:  int(atomic.LoadInt32(&s.seldepth)),
+		nodeCount: s.liveNodes(),
+		t:         s.gt.Elapsed(),
+		pv:        pv,
+		bound:     bound,
+		multiPV:   line,
+		hashfull:  mainTt.hashfull(currentSearchId()),
+	}
+}
+
+// visit counts a node for progress reports and the node limit, and records the selective depth
+// reached. Once the first iteration is complete, the search is aborted when the node limit is hit.
+func (s *Search) visit(w *Worker, ply int) {
+	nodes := atomic.AddInt64(&w.nodes, 1)
+	if s.nodeLimit > 0 && nodes&NODE_CHECK_MASK == 0 && atomic.LoadInt32(&s.completed) > 0 &&
+		s.liveNodes() >= s.nodeLimit {
+		s.Abort()
+	}
+	for {
+		seldepth := atomic.LoadInt32(&s.seldepth)
+		if int32(ply) <= seldepth || atomic.CompareAndSwapInt32(&s.seldepth, seldepth, int32(ply)) {
+			return
+		}
+	}
+}
+
+// workerNodes gives the total number of nodes visited so far by the workers used for this search.
+func (s *Search) workerNodes() int64 {
+	if s.privateWorker != nil {
+		return atomic.LoadInt64(&s.privateWorker.nodes)
+	}
+	var nodes int64
+	for _, w := range loadBalancer.workers {
+		nodes += atomic.LoadInt64(&w.nodes)
+	}
+	return nodes
+}
+
+// liveNodes gives the number of nodes visited since the search started, including those in the
+// current iteration.
+func (s *Search) liveNodes() int {
+	return int(s.workerNodes() - s.nodeBase)
+}
+
+// startPeriodicInfo reports the node count and hash usage to the GUI every INFO_INTERVAL, so that
+// progress is visible during long iterations. Returns a function that stops the reports.
+func (s *Search) startPeriodicInfo() func() {
+	if s.uci == nil {
+		return func() {}
+	}
+	id := currentSearchId()
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(INFO_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.uci.Progress(s.liveNodes(), mainTt.hashfull(id), s.gt.Elapsed())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
 func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	spType int, checked bool) (int, int) {
 	select {
@@ -206,10 +389,11 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	score, best, oldAlpha := -INF, -INF, alpha
 	sum := 1
 
-	var nullDepth, hashResult, eval, subtotal, total, legalSearched, childType, rDepth int
-	// var hashScore int
-	canPrune, fPrune, canReduce := false, false, false
+	var nullDepth, hashResult, hashScore, eval, subtotal, total, legalSearched, childType, rDepth int
+	canPrune, fPrune, canReduce, singularNode := false, false, false, false
 	bestMove, firstMove := NO_MOVE, NO_MOVE
+	var quiets [MAX_QUIETS]Move
+	quietCount := 0
 
 	// if the is_sp flag is set, a worker has just been assigned to this split point.
 	// the SP master has already handled most of the pruning, so just read the latest values
@@ -226,6 +410,7 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	}
 
 	thisStk = &stk[ply]
+	s.visit(brd.worker, ply)
 
 	if nodeType != Y_PV { // Mate Distance Pruning
 		mateValue := max(ply-MATE, alpha)
@@ -235,8 +420,8 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	}
 
 	thisStk.hashKey = brd.hashKey
-	if stk.IsRepetition(ply, brd.halfmoveClock) { // check for draw by threefold repetition
-		return ply - DRAW_VALUE, 1
+	if stk.IsRepetition(ply, brd.halfmoveClock, s.history) { // check for draw by threefold repetition
+		return s.drawScore[brd.c], 1
 	}
 
 	inCheck = thisStk.inCheck
@@ -246,13 +431,17 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 		if isCheckmate(brd, inCheck) {
 			return ply - MATE, 1
 		} else {
-			return ply - DRAW_VALUE, 1
+			return s.drawScore[brd.c], 1
 		}
 	}
 
 	nullDepth = depth - 4
-	firstMove, hashResult = mainTt.probe(brd, depth, nullDepth, alpha, beta, &score)
-	// hashScore = score
+	if thisStk.singularMove == NO_MOVE {
+		firstMove, hashResult = mainTt.probe(brd, depth, nullDepth, alpha, beta, &score)
+		hashScore = score
+	} else { // exclusion search. The TT entry for this node was produced by the excluded move.
+		hashResult = NO_MATCH
+	}
 
 	eval = evaluate(brd, alpha, beta)
 	thisStk.eval = int16(eval)
@@ -260,7 +449,8 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	if nodeType != Y_PV {
 		if (hashResult & CUTOFF_FOUND) > 0 { // Hash hit valid for current bounds.
 			return score, sum
-		} else if !inCheck && thisStk.canNull && hashResult != AVOID_NULL && depth >= NULL_MOVE_MIN &&
+		} else if !inCheck && thisStk.canNull && hashResult != AVOID_NULL && searchConfig.nullMove &&
+			depth >= searchConfig.nullMoveMin &&
 			!brd.PawnsOnly() && eval >= beta { // Null-move pruning
 
 			score, subtotal = s.nullMake(brd, stk, beta, nullDepth, ply, checked)
@@ -282,7 +472,8 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	}
 
 	// skip IID when in check?
-	if !inCheck && nodeType == Y_PV && hashResult == NO_MATCH && depth >= IID_MIN {
+	if !inCheck && nodeType == Y_PV && hashResult == NO_MATCH && searchConfig.iid &&
+		depth >= searchConfig.iidMin {
 		// No hash move available. Use IID to get a decent first move to try.
 		score, subtotal = s.ybw(brd, stk, alpha, beta, depth-2, ply, Y_PV, SP_NONE, checked)
 		sum += subtotal
@@ -291,7 +482,7 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 		}
 	}
 
-	selector = NewMoveSelector(brd, thisStk, &s.htable, inCheck, firstMove)
+	selector = NewMoveSelector(brd, thisStk, s.htable, inCheck, firstMove)
 
 searchMoves:
 
@@ -302,13 +493,13 @@ searchMoves:
 	if inCheck {
 		checked = true // Don't extend on the first check in the current variation.
 	} else if ply > 0 && alpha > -MIN_MATE {
-		if depth <= F_PRUNE_MAX && !brd.PawnsOnly() {
+		if searchConfig.futility && depth <= searchConfig.fPruneMax && !brd.PawnsOnly() {
 			canPrune = true
 			if eval+BISHOP_VALUE < alpha {
 				fPrune = true
 			}
 		}
-		if depth >= LMR_MIN {
+		if searchConfig.lmr && depth >= searchConfig.lmrMin {
 			canReduce = true
 		}
 	}
@@ -317,20 +508,20 @@ searchMoves:
 	// 	fmt.Printf("%d:%t, %b\n", ply, hashResult&EXACT_FOUND > 0, hashResult)
 	// }
 
-	// singularNode := ply > 0 && nodeType == Y_CUT && (hashResult&BETA_FOUND) > 0 &&
-	// 	firstMove.IsMove() && depth > 6 && thisStk.canNull
+	// A hash move that failed high at sufficient depth is a candidate for a singular extension.
+	// Split point servants never test for singularity; the test is made by the master before
+	// the node can be split.
+	if searchConfig.singular && spType == SP_NONE && ply > 0 && nodeType != Y_ALL && !inCheck &&
+		(hashResult&BETA_FOUND) > 0 && firstMove.IsMove() && depth >= SINGULAR_MIN &&
+		thisStk.canNull && abs(hashScore) < MIN_MATE {
+		singularNode = true
+	}
 
 	memento := brd.NewMemento()
 	recycler := brd.worker.recycler
 
 	for m, stage := selector.Next(recycler, spType); m != NO_MOVE; m, stage = selector.Next(recycler, spType) {
 
-		if ply == 0 && s.restrictSearch {
-			if !s.moveAllowed(m) { // restrict search to only those moves requested by the GUI.
-				continue
-			}
-		}
-
 		if m == thisStk.singularMove {
 			continue
 		}
@@ -338,24 +529,25 @@ searchMoves:
 		mayPromote := brd.MayPromote(m)
 		tryPrune := canPrune && stage == STAGE_REMAINING && legalSearched > 0 && !mayPromote
 
-		if tryPrune && getSee(brd, m.From(), m.To(), EMPTY) < 0 {
+		if tryPrune && !m.IsCastle() && getSee(brd, m.From(), m.To(), EMPTY) < 0 {
 			continue // prune quiet moves that result in loss of moving piece
 		}
 
 		total = 0
 		rDepth = depth
 
-		// // TODO: verify safety for parallel search
-		// // Singular extension
-		// if singularNode && spType == SP_NONE && m == firstMove {
-		// 	sBeta := hashScore - (depth << 1)
-		// 	thisStk.singularMove, thisStk.canNull = m, false
-		// 	score, total = s.ybw(brd, stk, sBeta-1, sBeta, depth/2, ply, Y_CUT, SP_NONE, checked)
-		// 	thisStk.singularMove, thisStk.canNull = NO_MOVE, true
-		// 	if score < sBeta {
-		// 		rDepth = depth + 1 // extend moves that are expected to be the only move searched.
-		// 	}
-		// }
+		// Singular extension: if every alternative to the hash move fails low against a margin
+		// below the hash score, extend the hash move. The exclusion search runs on this goroutine's
+		// own stack item; any split point it creates copies the excluded move to its servants.
+		if singularNode && spType == SP_NONE && m == firstMove {
+			sBeta := hashScore - (depth << 1)
+			thisStk.singularMove, thisStk.canNull = m, false
+			score, total = s.ybw(brd, stk, sBeta-1, sBeta, depth/2, ply, Y_CUT, SP_NONE, checked)
+			thisStk.singularMove, thisStk.canNull = NO_MOVE, true
+			if score < sBeta {
+				rDepth = depth + 1 // extend moves that are expected to be the only move searched.
+			}
+		}
 
 		makeMove(brd, m)
 
@@ -383,6 +575,7 @@ searchMoves:
 		}
 
 		stk[ply+1].inCheck = givesCheck // avoid having to recalculate in_check at beginning of search.
+		stk[ply+1].prevMoves = [2]Move{m, thisStk.prevMoves[0]}
 
 		// time to search deeper:
 		if nodeType == Y_PV && alpha > oldAlpha {
@@ -417,7 +610,7 @@ searchMoves:
 					sp.Unlock()
 					loadBalancer.RemoveSP(brd.worker)
 					// the servant that found the cutoff has already stored the cutoff info.
-					mainTt.store(brd, bestMove, depth, LOWER_BOUND, best)
+					s.store(brd, thisStk, bestMove, depth, LOWER_BOUND, best)
 					return best, sum
 				} else { // A cutoff has been found somewhere above this SP.
 					sp.cancel = true
@@ -435,6 +628,11 @@ searchMoves:
 			}
 		}
 
+		if m.IsQuiet() && quietCount < MAX_QUIETS {
+			quiets[quietCount] = m // quiets searched before a cutoff have their history reduced.
+			quietCount++
+		}
+
 		if spType != SP_NONE {
 			sp.Lock() // get the latest info under lock protection
 			alpha, beta, best, bestMove = sp.alpha, sp.beta, sp.best, sp.bestMove
@@ -457,12 +655,12 @@ searchMoves:
 				if score > alpha {
 					alpha, sp.alpha = score, score
 					if score >= beta {
-						storeCutoff(&stk[ply], &s.htable, m, brd.c, total)
+						storeCutoff(&stk[ply], s.htable, m, brd.c, depth, quiets[:quietCount])
 						sp.cancel = true
 						sp.Unlock()
 						if spType == SP_MASTER {
 							loadBalancer.RemoveSP(brd.worker)
-							mainTt.store(brd, m, depth, LOWER_BOUND, score)
+							s.store(brd, thisStk, m, depth, LOWER_BOUND, score)
 							// selector.Recycle(recycler)
 							return score, sum
 						} else { // sp_type == SP_SERVANT
@@ -481,8 +679,8 @@ searchMoves:
 				}
 				if score > alpha {
 					if score >= beta {
-						storeCutoff(thisStk, &s.htable, m, brd.c, total) // what happens on refutation of main pv?
-						mainTt.store(brd, m, depth, LOWER_BOUND, score)
+						storeCutoff(thisStk, s.htable, m, brd.c, depth, quiets[:quietCount]) // what happens on refutation of main pv?
+						s.store(brd, thisStk, m, depth, LOWER_BOUND, score)
 						selector.Recycle(recycler)
 						return score, sum
 					}
@@ -492,7 +690,7 @@ searchMoves:
 			}
 			legalSearched += 1
 			// Determine if this would be a good location to begin searching in parallel.
-			if canSplit(brd, ply, depth, nodeType, legalSearched, stage) {
+			if s.privateWorker == nil && canSplit(brd, ply, depth, nodeType, legalSearched, stage) {
 				sp = CreateSP(s, brd, stk, selector, bestMove, alpha, beta, best, depth, ply,
 					legalSearched, nodeType, sum, checked)
 				// register the split point in the appropriate SP list, and notify any idle workers.
@@ -535,19 +733,21 @@ searchMoves:
 
 	if legalSearched > 0 {
 		if alpha > oldAlpha {
-			mainTt.store(brd, bestMove, depth, EXACT, best)
+			s.store(brd, thisStk, bestMove, depth, EXACT, best)
 			return best, sum
 		} else {
-			mainTt.store(brd, bestMove, depth, UPPER_BOUND, best)
+			s.store(brd, thisStk, bestMove, depth, UPPER_BOUND, best)
 			return best, sum
 		}
+	} else if thisStk.singularMove != NO_MOVE {
+		return alpha, sum // the excluded move is the only legal move, so it is singular.
 	} else {
 		if inCheck { // Checkmate.
 			mainTt.store(brd, NO_MOVE, depth, EXACT, ply-MATE)
 			return ply - MATE, sum
-		} else { // Draw.
+		} else { // Draw. Contempt depends on the root side, so the TT entry is scored evenly.
 			mainTt.store(brd, NO_MOVE, depth, EXACT, 0)
-			return ply - DRAW_VALUE, sum
+			return s.drawScore[brd.c], sum
 		}
 	}
 }
@@ -557,10 +757,11 @@ searchMoves:
 func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int) (int, int) {
 
 	thisStk := &stk[ply]
+	s.visit(brd.worker, ply)
 
 	thisStk.hashKey = brd.hashKey
-	if stk.IsRepetition(ply, brd.halfmoveClock) { // check for draw by threefold repetition
-		return ply - DRAW_VALUE, 1
+	if stk.IsRepetition(ply, brd.halfmoveClock, s.history) { // check for draw by threefold repetition
+		return s.drawScore[brd.c], 1
 	}
 
 	inCheck := thisStk.inCheck
@@ -568,7 +769,7 @@ func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int)
 		if isCheckmate(brd, inCheck) {
 			return ply - MATE, 1
 		} else {
-			return ply - DRAW_VALUE, 1
+			return s.drawScore[brd.c], 1
 		}
 	}
 
@@ -591,7 +792,8 @@ func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int)
 
 	legalMoves := false
 	memento := brd.NewMemento()
-	selector := NewQMoveSelector(brd, thisStk, &s.htable, brd.worker.recycler, inCheck, depth >= MIN_CHECK_DEPTH)
+	selector := NewQMoveSelector(brd, thisStk, s.htable, brd.worker.recycler, inCheck,
+		depth >= searchConfig.minCheckDepth)
 
 	var mayPromote, givesCheck bool
 	for m := selector.Next(); m != NO_MOVE; m = selector.Next() {
@@ -609,6 +811,7 @@ func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int)
 		}
 
 		stk[ply+1].inCheck = givesCheck // avoid having to recalculate in_check at beginning of search.
+		stk[ply+1].prevMoves = [2]Move{m, thisStk.prevMoves[0]}
 
 		score, total = s.quiescence(brd, stk, -beta, -alpha, depth-1, ply+1)
 		score = -score
@@ -643,6 +846,7 @@ func (s *Search) nullMake(brd *Board, stk Stack, beta, nullDepth, ply int, check
 	brd.enpTarget = SQ_INVALID
 	stk[ply+1].inCheck = false // Impossible to give check from a legal position by standing pat.
 	stk[ply+1].canNull = false
+	stk[ply+1].prevMoves = [2]Move{NO_MOVE, stk[ply].prevMoves[0]}
 	score, sum := s.ybw(brd, stk, -beta, (-beta)+1, nullDepth-1, ply+1, Y_CUT, SP_NONE, checked)
 	stk[ply+1].canNull = true
 	brd.c ^= 1
@@ -651,6 +855,14 @@ func (s *Search) nullMake(brd *Board, stk Stack, beta, nullDepth, ply int, check
 	return -score, sum
 }
 
+// store saves the result of a node to the TT. Results of exclusion searches are not stored,
+// since they do not account for every move.
+func (s *Search) store(brd *Board, thisStk *StackItem, m Move, depth, entryType, value int) {
+	if thisStk.singularMove == NO_MOVE {
+		mainTt.store(brd, m, depth, entryType, value)
+	}
+}
+
 func (s *Search) determineChildType(nodeType, legalSearched int) int {
 	switch nodeType {
 	case Y_PV:
@@ -675,7 +887,7 @@ func (s *Search) determineChildType(nodeType, legalSearched int) int {
 
 // Determine if the current node is a good place to start searching in parallel.
 func canSplit(brd *Board, ply, depth, nodeType, legalSearched, stage int) bool {
-	if depth >= MIN_SPLIT {
+	if depth >= searchConfig.minSplit {
 		switch nodeType {
 		case Y_PV:
 			return ply > 0 && legalSearched > 0
@@ -688,9 +900,9 @@ func canSplit(brd *Board, ply, depth, nodeType, legalSearched, stage int) bool {
 	return false
 }
 
-func storeCutoff(thisStk *StackItem, htable *HistoryTable, m Move, c uint8, total int) {
+func storeCutoff(thisStk *StackItem, htable *HistoryTable, m Move, c uint8, depth int, quiets []Move) {
 	if m.IsQuiet() {
-		htable.Store(m, c, total)
+		htable.Update(m, c, thisStk.prevMoves, quiets, depth)
 		thisStk.StoreKiller(m) // store killer moves in stack for this Goroutine.
 	}
 }
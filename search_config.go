@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Search and evaluation settings that can be changed at runtime via UCI options. This allows
+// pruning and reduction techniques to be tuned or disabled for ablation matches without
+// rebuilding the engine. Options are only changed while the engine is idle, so the search reads
+// these settings without synchronization.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type SearchConfig struct {
+	minSplit      int // Do not begin parallel search below this depth.
+	fPruneMax     int // Do not use futility pruning when above this depth.
+	lmrMin        int // Do not use late move reductions below this depth.
+	iidMin        int // Do not use internal iterative deepening below this depth.
+	nullMoveMin   int // Do not use null-move pruning below this depth.
+	minCheckDepth int // During Q-Search, consider all evasions when in check at or above this depth.
+
+	lazyEvalMargin int
+	tempoBonus     int
+
+	contempt    int  // penalty for draws from the root side's point of view, in centipawns.
+	analyseMode bool // when analysing, draws are scored as zero for both sides.
+	multiPV     int  // the number of principal variations to search and report.
+
+	moveOverhead int // time in milliseconds reserved per move for communication with the GUI.
+
+	nullMove, lmr, futility, iid, aspiration, singular bool
+}
+
+var defaultSearchConfig = SearchConfig{
+	minSplit:       2,
+	fPruneMax:      2,
+	lmrMin:         2,
+	iidMin:         4,
+	nullMoveMin:    3,
+	minCheckDepth:  -2,
+	lazyEvalMargin: BISHOP_VALUE,
+	tempoBonus:     5,
+	contempt:       20,
+	multiPV:        1,
+	moveOverhead:   10,
+	nullMove:       true,
+	lmr:            true,
+	futility:       true,
+	iid:            true,
+	aspiration:     true,
+	singular:       true,
+}
+
+var searchConfig = defaultSearchConfig
+
+// UCIOption describes a spin or check option. Exactly one of spin or check is set.
+type UCIOption struct {
+	name     string
+	spin     *int
+	check    *bool
+	min, max int
+}
+
+var searchOptions = []UCIOption{
+	{name: "Contempt", spin: &searchConfig.contempt, min: -200, max: 200},
+	{name: "UCI_AnalyseMode", check: &searchConfig.analyseMode},
+	{name: "MultiPV", spin: &searchConfig.multiPV, min: 1, max: MAX_MULTIPV},
+	{name: "Move Overhead", spin: &searchConfig.moveOverhead, min: 0, max: 5000},
+	{name: "Null Move Pruning", check: &searchConfig.nullMove},
+	{name: "Null Move Min Depth", spin: &searchConfig.nullMoveMin, min: 2, max: MAX_DEPTH},
+	{name: "Late Move Reductions", check: &searchConfig.lmr},
+	{name: "LMR Min Depth", spin: &searchConfig.lmrMin, min: 2, max: MAX_DEPTH},
+	{name: "Futility Pruning", check: &searchConfig.futility},
+	{name: "Futility Max Depth", spin: &searchConfig.fPruneMax, min: 1, max: 8},
+	{name: "Internal Iterative Deepening", check: &searchConfig.iid},
+	{name: "IID Min Depth", spin: &searchConfig.iidMin, min: 2, max: MAX_DEPTH},
+	{name: "Aspiration Windows", check: &searchConfig.aspiration},
+	{name: "Singular Extensions", check: &searchConfig.singular},
+	{name: "Min Split Depth", spin: &searchConfig.minSplit, min: 1, max: MAX_DEPTH},
+	{name: "QSearch Check Depth", spin: &searchConfig.minCheckDepth, min: -8, max: 0},
+	{name: "Lazy Eval Margin", spin: &searchConfig.lazyEvalMargin, min: 0, max: 2000},
+	{name: "Tempo Bonus", spin: &searchConfig.tempoBonus, min: 0, max: 100},
+}
+
+// String gives the option declaration sent to the GUI, with the current setting as the default.
+func (opt UCIOption) String() string {
+	if opt.check != nil {
+		return fmt.Sprintf("option name %s type check default %t\n", opt.name, *opt.check)
+	}
+	return fmt.Sprintf("option name %s type spin default %d min %d max %d\n", opt.name, *opt.spin,
+		opt.min, opt.max)
+}
+
+func (opt UCIOption) Set(value string) error {
+	if opt.check != nil {
+		b, err := parseCheck(opt.name, value)
+		if err == nil {
+			*opt.check = b
+		}
+		return err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < opt.min || n > opt.max {
+		return fmt.Errorf("invalid value %q for %s, expected %d to %d", value, opt.name, opt.min, opt.max)
+	}
+	*opt.spin = n
+	return nil
+}
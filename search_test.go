@@ -5,10 +5,198 @@
 
 package main
 
-import "testing"
+import (
+	"runtime"
+	"testing"
+	"time"
+)
 
 func TestPlayingStrength(t *testing.T) {
 	printName()
 	timeout := 2000
 	RunTestSuite("test_suites/wac_300.epd", MAX_DEPTH, timeout)
 }
+
+// Every legal move for white reaches the fifty-move rule, so the root score is the value of a
+// draw to white.
+func TestContempt(t *testing.T) {
+	defer func() { searchConfig = defaultSearchConfig }()
+	tests := []struct {
+		contempt int
+		analyse  bool
+		expected int
+	}{
+		{0, false, 0},
+		{25, false, -25},
+		{-25, false, 25},
+		{25, true, 0},
+	}
+	for _, test := range tests {
+		searchConfig.contempt, searchConfig.analyseMode = test.contempt, test.analyse
+		resetMainTt()
+		brd := ParseFENString("8/8/8/8/8/2k5/1q6/7K w - - 99 80")
+		gt := NewGameTimer(0, brd.c)
+		gt.SetMoveTime(MAX_TIME)
+		s := NewSearch(SearchParams{4, false, false}, gt, nil, nil, nil)
+		s.Start(brd)
+		if s.bestScore[WHITE] != test.expected {
+			t.Errorf("contempt %d, analyse mode %t: expected score %d, got %d", test.contempt,
+				test.analyse, test.expected, s.bestScore[WHITE])
+		}
+	}
+}
+
+// Stalemates are stored in the TT as even, so that the stored score doesn't depend on the root side
+// or on the contempt setting.
+func TestStalemateStoredWithoutContempt(t *testing.T) {
+	defer func() { searchConfig = defaultSearchConfig }()
+	searchConfig.contempt = 25
+	resetMainTt()
+	brd := ParseFENString("7k/8/4QK2/8/8/8/8/8 w - - 0 1") // Qf7 is stalemate.
+	gt := NewGameTimer(0, brd.c)
+	gt.SetMoveTime(MAX_TIME)
+	NewSearch(SearchParams{2, false, false}, gt, nil, nil, nil).Start(brd)
+
+	var score int
+	stalemate := ParseFENString("7k/8/4QK2/8/8/8/8/8 w - - 0 1")
+	m, _ := ParseLegalMove(stalemate, "e6f7")
+	makeMove(stalemate, m)
+	if _, result := mainTt.probe(stalemate, 0, 0, -INF, INF, &score); result == NO_MATCH || score != 0 {
+		t.Errorf("expected stalemate to be stored with a score of 0, got %d", score)
+	}
+}
+
+// With a single worker, repeated searches must produce identical results. Split points are still
+// created in single-thread mode, so this also checks that the exclusion searches made for
+// singular extensions leave the stack as they found it.
+func TestSearchDeterminism(t *testing.T) {
+	defer setupLoadBalancer(runtime.NumCPU())
+	positions := []string{ // both positions include singular extension tests at depth 8.
+		"1k5r/pppbn1pp/4q1r1/1P3p2/2NPp3/1QP5/P4PPP/R1B1R1K1 w - - 0 1",
+		"r1q3rk/1ppbb1p1/4Np1p/p3pP2/P3P3/2N4R/1PP1Q1PP/3R2K1 w - - 0 1",
+	}
+	for _, fen := range positions {
+		var results [2]*Search
+		for i := range results {
+			setupLoadBalancer(1) // fresh workers, so that no killers carry over between searches.
+			resetMainTt()
+			brd := ParseFENString(fen)
+			gt := NewGameTimer(0, brd.c)
+			gt.SetMoveTime(MAX_TIME)
+			results[i] = NewSearch(SearchParams{8, false, false}, gt, nil, nil, nil)
+			results[i].Start(brd)
+		}
+		a, b := results[0], results[1]
+		if a.bestMove != b.bestMove || a.bestScore != b.bestScore || a.nodes != b.nodes {
+			t.Errorf("%s: searches differ: %s %v %d nodes, then %s %v %d nodes", fen, a.bestMove.ToUCI(),
+				a.bestScore, a.nodes, b.bestMove.ToUCI(), b.bestScore, b.nodes)
+		}
+	}
+}
+
+// History scores stay within bounds under repeated updates, and the most recent refutation of the
+// previous move is sorted ahead of quiet moves with higher history scores.
+func TestHistoryUpdate(t *testing.T) {
+	htable := new(HistoryTable)
+	prev := [2]Move{NewRegularMove(E2, E4, PAWN), NO_MOVE}
+	good, counter := NewRegularMove(G1, F3, KNIGHT), NewRegularMove(B1, C3, KNIGHT)
+	for i := 0; i < 1000; i++ {
+		htable.Update(good, BLACK, prev, []Move{counter, good}, MAX_DEPTH)
+	}
+	if score := htable.butterfly[BLACK][KNIGHT][F3]; score > HISTORY_MAX {
+		t.Errorf("expected history score within %d, got %d", HISTORY_MAX, score)
+	}
+	if score := htable.butterfly[BLACK][KNIGHT][C3]; score < -HISTORY_MAX {
+		t.Errorf("expected history score within %d, got %d", -HISTORY_MAX, score)
+	}
+	htable.Update(counter, BLACK, prev, nil, 1)
+	nh := htable.Node(BLACK, prev)
+	if nh.Probe(KNIGHT, BLACK, C3) <= nh.Probe(KNIGHT, BLACK, F3) {
+		t.Errorf("expected counter move %s to be sorted first", counter.ToUCI())
+	}
+}
+
+// The soft limit is the share of the clock for the current move, and the hard limit is the most
+// that can be used on it.
+func TestTimeLimits(t *testing.T) {
+	defer func() { searchConfig = defaultSearchConfig }()
+	searchConfig.moveOverhead = 50
+	tests := []struct {
+		name                 string
+		remaining, inc, move time.Duration
+		movesToGo            int
+		soft, hard           time.Duration
+	}{
+		{"sudden death", 10 * time.Second, 0, 0, 0, 131818181, 659090905},
+		{"increment", 10 * time.Second, time.Second, 0, 0, 1113636363, 5529318181},
+		{"last move before time control", time.Second, 0, 0, 1, 945 * time.Millisecond, 945 * time.Millisecond},
+		{"movestogo", 10 * time.Second, 0, 0, 2, 4950 * time.Millisecond, 7447500 * time.Microsecond},
+		{"movetime", 10 * time.Second, 0, time.Second, 0, 0, 950 * time.Millisecond},
+	}
+	for _, test := range tests {
+		gt := NewGameTimer(0, WHITE)
+		gt.remaining[WHITE], gt.inc[WHITE], gt.movesToGo = test.remaining, test.inc, test.movesToGo
+		if test.move > 0 {
+			gt.SetMoveTime(test.move)
+		}
+		gt.setLimits()
+		if gt.softLimit != test.soft || gt.hardLimit != test.hard {
+			t.Errorf("%s: expected limits %v, %v, got %v, %v", test.name, test.soft, test.hard,
+				gt.softLimit, gt.hardLimit)
+		}
+	}
+}
+
+// Time spent pondering counts toward the soft limit, so a search that has pondered for longer than
+// its share of the clock is stopped as soon as ponderhit starts the clock. The clock is large enough
+// that the soft limit (about a minute) cannot be reached while the test runs without pondering.
+func TestPonderHit(t *testing.T) {
+	for _, pondered := range []time.Duration{0, time.Hour} {
+		gt := NewGameTimer(0, WHITE)
+		gt.remaining[WHITE] = time.Hour
+		s := NewSearch(SearchParams{MAX_DEPTH, false, true}, gt, nil, nil, nil)
+		gt.startTime = gt.startTime.Add(-pondered)
+		gt.SoftLimitReached(1) // the soft limit isn't checked before the clock is started.
+		gt.Start()
+		gt.Stop()
+		select {
+		case <-s.cancel:
+			if pondered == 0 {
+				t.Errorf("expected search to continue after ponderhit")
+			}
+		default:
+			if pondered > 0 {
+				t.Errorf("expected search to stop on ponderhit after pondering for %v", pondered)
+			}
+		}
+	}
+}
+
+// A search stopped before completing an iteration still returns a legal move.
+func TestStopBeforeFirstIteration(t *testing.T) {
+	gt := NewGameTimer(0, WHITE)
+	gt.SetMoveTime(MAX_TIME)
+	s := NewSearch(SearchParams{MAX_DEPTH, false, false}, gt, nil, nil, nil)
+	s.Abort()
+	s.Start(StartPos())
+	if !s.bestMove.IsMove() {
+		t.Errorf("expected a best move after stopping the search")
+	}
+}
+
+// The node limit stops a search part way through an iteration, rather than at the end of it.
+func TestNodeLimit(t *testing.T) {
+	limit := 20000
+	gt := NewGameTimer(0, WHITE)
+	gt.SetMoveTime(MAX_TIME)
+	s := NewSearch(SearchParams{MAX_DEPTH, false, false}, gt, nil, nil, nil)
+	s.privateWorker, s.nodeLimit = NewWorker(0), limit
+	s.Start(StartPos())
+	if nodes := s.liveNodes(); nodes < limit || nodes > limit+NODE_CHECK_MASK {
+		t.Errorf("expected search to stop within %d nodes of the limit of %d, got %d nodes",
+			NODE_CHECK_MASK, limit, nodes)
+	}
+	if !s.bestMove.IsMove() {
+		t.Errorf("expected a best move after reaching the node limit")
+	}
+}
@@ -42,12 +42,19 @@ type AbstractSelector struct {
 	brd            *Board
 	thisStk        *StackItem
 	htable         *HistoryTable
+	hist           NodeHistory
 }
 
 func (s *AbstractSelector) CurrentStage() int {
 	return s.stage - 1
 }
 
+// history returns the history used to order quiet moves at this node.
+func (s *AbstractSelector) history() *NodeHistory {
+	s.hist = s.htable.Node(s.brd.c, s.thisStk.prevMoves)
+	return &s.hist
+}
+
 func (s *AbstractSelector) recycleList(recycler *Recycler, moves MoveList) {
 	if moves != nil {
 		recycler.Recycle(moves[0:0])
@@ -159,12 +166,12 @@ func (s *MoveSelector) NextBatch(recycler *Recycler) bool {
 			s.winning = recycler.AttemptReuse()
 			s.losing = recycler.AttemptReuse()
 			s.remainingMoves = recycler.AttemptReuse()
-			getEvasions(s.brd, s.htable, &s.winning, &s.losing, &s.remainingMoves)
+			getEvasions(s.brd, s.history(), &s.winning, &s.losing, &s.remainingMoves)
 			// fmt.Printf("%t,%t,%t,", len(s.winning) > 8, len(s.losing) > 8, len(s.remaining_moves) > 8)
 		} else {
 			s.winning = recycler.AttemptReuse()
 			s.losing = recycler.AttemptReuse()
-			getCaptures(s.brd, s.htable, &s.winning, &s.losing)
+			getCaptures(s.brd, s.history(), &s.winning, &s.losing)
 			// fmt.Printf("%t,%t,", len(s.winning) > 8, len(s.losing) > 8)
 		}
 		s.winning.Sort()
@@ -177,7 +184,7 @@ func (s *MoveSelector) NextBatch(recycler *Recycler) bool {
 	case STAGE_REMAINING:
 		if !s.inCheck {
 			s.remainingMoves = recycler.AttemptReuse()
-			getNonCaptures(s.brd, s.htable, &s.remainingMoves)
+			getNonCaptures(s.brd, s.history(), &s.remainingMoves)
 			// fmt.Printf("%t,", len(s.remaining_moves) > 8)
 		}
 		s.remainingMoves.Sort()
@@ -243,10 +250,10 @@ func (s *QMoveSelector) NextBatch() bool {
 			s.winning = s.recycler.AttemptReuse()
 			s.losing = s.recycler.AttemptReuse()
 			s.remainingMoves = s.recycler.AttemptReuse()
-			getEvasions(s.brd, s.htable, &s.winning, &s.losing, &s.remainingMoves)
+			getEvasions(s.brd, s.history(), &s.winning, &s.losing, &s.remainingMoves)
 		} else {
 			s.winning = s.recycler.AttemptReuse()
-			getWinningCaptures(s.brd, s.htable, &s.winning)
+			getWinningCaptures(s.brd, s.history(), &s.winning)
 		}
 		s.winning.Sort()
 		s.finished = len(s.winning)
@@ -259,7 +266,7 @@ func (s *QMoveSelector) NextBatch() bool {
 	case Q_STAGE_CHECKS:
 		if !s.inCheck && s.canCheck {
 			s.checks = s.recycler.AttemptReuse()
-			getChecks(s.brd, s.htable, &s.checks)
+			getChecks(s.brd, s.history(), &s.checks)
 			s.checks.Sort()
 		}
 		s.finished = len(s.checks)
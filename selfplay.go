@@ -0,0 +1,237 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Self-play training data generation.
+
+// Games are played by several engine instances concurrently. Each instance searches on its own
+// private worker (without parallel search) to a fixed node limit, and games begin from a random
+// book position and/or a number of random moves to ensure variety. After each game, quiet
+// positions are written out along with the search score and the final result of the game, one
+// position per line:
+//
+//   <FEN> | <score> | <result>
+//
+// The score is given in centipawns and the result as 1.0, 0.5 or 0.0, both from white's point
+// of view. This is the plain-text format read by the bullet trainer, and the result is also
+// recognized by the evaluation tuner. Positions are deduplicated by hash key.
+//
+// Giving each instance a TT of its own would multiply the memory used by the main TT, so
+// concurrent games share it. Entries are keyed by position, so sharing doesn't affect the
+// soundness of the search, but games aren't fully independent: a search may be guided by entries
+// from another game. Each game advances the search id, so that entries from earlier games are
+// replaced first.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SELFPLAY_MAX_PLIES = 400 // games reaching this length are scored as draws.
+)
+
+type SelfPlayConfig struct {
+	games       int
+	nodes       int // node limit per move.
+	concurrency int // number of games played at once.
+	randomPlies int // number of random moves played at the start of each game.
+	bookPath    string
+	outPath     string
+}
+
+type SelfPlayPosition struct {
+	fen     string
+	hashKey uint64
+	score   int // from white's point of view.
+}
+
+type SelfPlayWriter struct {
+	sync.Mutex
+	w         *bufio.Writer
+	seen      map[uint64]bool
+	games     int
+	positions int
+}
+
+// Write records the positions from a finished game, skipping any positions already written.
+// Returns the number of games and positions written so far.
+func (sw *SelfPlayWriter) Write(positions []SelfPlayPosition, result float64) (int, int, error) {
+	sw.Lock()
+	defer sw.Unlock()
+	for _, pos := range positions {
+		if sw.seen[pos.hashKey] {
+			continue
+		}
+		sw.seen[pos.hashKey] = true
+		if _, err := fmt.Fprintf(sw.w, "%s | %d | %.1f\n", pos.fen, pos.score, result); err != nil {
+			return sw.games, sw.positions, err
+		}
+		sw.positions++
+	}
+	sw.games++
+	return sw.games, sw.positions, nil
+}
+
+func RunSelfPlay(cfg SelfPlayConfig) error {
+	var book []*Board
+	if cfg.bookPath != "" {
+		var err error
+		if book, err = loadSelfPlayBook(cfg.bookPath); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(cfg.outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sw := &SelfPlayWriter{w: bufio.NewWriter(f), seen: make(map[uint64]bool)}
+
+	start := time.Now()
+	gameIds := make(chan int)
+	errs := make(chan error, cfg.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w, htable := NewWorker(uint8(i)), new(HistoryTable)
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+			for id := range gameIds {
+				positions, result := playSelfPlayGame(cfg, book, w, htable, rng)
+				games, written, err := sw.Write(positions, result)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if (id+1)%100 == 0 {
+					fmt.Printf("%d games, %d positions (%.1fs)\n", games, written,
+						time.Since(start).Seconds())
+				}
+			}
+		}(i)
+	}
+	for id := 0; id < cfg.games; id++ {
+		select {
+		case gameIds <- id:
+		case err := <-errs:
+			close(gameIds)
+			wg.Wait()
+			return err
+		}
+	}
+	close(gameIds)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	fmt.Printf("%d games, %d positions written to %s (%.1fs)\n", sw.games, sw.positions,
+		cfg.outPath, time.Since(start).Seconds())
+	return sw.w.Flush()
+}
+
+// playSelfPlayGame plays a single game and returns the quiet positions encountered along with the
+// result of the game from white's point of view.
+func playSelfPlayGame(cfg SelfPlayConfig, book []*Board, w *Worker, htable *HistoryTable,
+	rng *rand.Rand) ([]SelfPlayPosition, float64) {
+	htable.Clear()
+	w.stk.ClearKillers()
+	nextSearchId()
+	var brd *Board
+	if len(book) > 0 {
+		brd = book[rng.Intn(len(book))].Copy()
+	} else {
+		brd = StartPos()
+	}
+	var positions []SelfPlayPosition
+	gs := NewGameState(brd)
+
+	for ply := 0; ply < SELFPLAY_MAX_PLIES; ply++ {
+		if gs.IsOver() {
+			return positions, selfPlayResults[gs.Result()]
+		}
+		if ply < cfg.randomPlies {
+			moves := brd.LegalMoves()
+			gs.MakeMove(moves[rng.Intn(len(moves))])
+			continue
+		}
+
+		gt := NewGameTimer(ply/2, brd.c)
+		gt.SetMoveTime(MAX_TIME)
+		s := NewSearch(SearchParams{MAX_DEPTH, false, false}, gt, nil, htable, nil)
+		s.privateWorker, s.nodeLimit, s.history = w, cfg.nodes, gs.history
+		s.contempt = 0 // both sides are played by the engine, so draws are scored evenly.
+		s.Start(brd.Copy())
+		if !s.bestMove.IsMove() {
+			return positions, 0.5
+		}
+		score := s.bestScore[brd.c]
+		if score >= MIN_MATE || score <= -MIN_MATE { // adjudicate once a forced mate is found.
+			if score > 0 {
+				return positions, selfPlayResult(brd.c)
+			}
+			return positions, selfPlayResult(brd.Enemy())
+		}
+		if !brd.InCheck() && s.bestMove.IsQuiet() {
+			if brd.c == BLACK {
+				score = -score
+			}
+			positions = append(positions, SelfPlayPosition{brd.ToFEN(), brd.hashKey, score})
+		}
+		gs.MakeMove(s.bestMove)
+	}
+	return positions, 0.5
+}
+
+var selfPlayResults = map[string]float64{"1-0": 1.0, "1/2-1/2": 0.5, "0-1": 0.0}
+
+func selfPlayResult(winner uint8) float64 {
+	if winner == WHITE {
+		return 1.0
+	}
+	return 0.0
+}
+
+// loadSelfPlayBook reads one opening position per line, given as a FEN or EPD string. Blank lines
+// are ignored, and any invalid position is reported along with its line number.
+func loadSelfPlayBook(path string) ([]*Board, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var book []*Board
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(strings.Split(scanner.Text(), ";")[0])
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 4 {
+			fields = fields[:4]
+		}
+		brd, err := ParseFENFields(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		book = append(book, brd)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(book) == 0 {
+		return nil, fmt.Errorf("no positions found in %s", path)
+	}
+	return book, nil
+}
@@ -0,0 +1,115 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Book positions are validated when the book is loaded, so an illegal position is reported by
+// line number before any game is played.
+func TestLoadSelfPlayBook(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		book string
+		err  string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1\n\n" +
+			"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - ; c0 \"Italian\"\n", ""},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3\n" +
+			"4k3/8/8/8/8/8/8/4R1K1 w - -\n", "book.txt:2:"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq -\n", "book.txt:1:"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "book.txt")
+		if err := os.WriteFile(path, []byte(test.book), 0644); err != nil {
+			t.Fatal(err)
+		}
+		book, err := loadSelfPlayBook(path)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("expected book to load, got %v", err)
+			} else if len(book) != 2 {
+				t.Errorf("expected 2 book positions, got %d", len(book))
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error containing %q, got %v", test.err, err)
+		}
+	}
+}
+
+// A short run of concurrent games writes each position once, with the side to move not in check
+// and the game result given as 1.0, 0.5 or 0.0.
+func TestSelfPlay(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "selfplay.txt")
+	cfg := SelfPlayConfig{games: 4, nodes: 2000, concurrency: 2, randomPlies: 8, outPath: outPath}
+	if err := RunSelfPlay(cfg); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seen := make(map[uint64]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " | ")
+		if len(fields) != 3 {
+			t.Fatalf("expected <FEN> | <score> | <result>, got %q", scanner.Text())
+		}
+		brd, err := ParseFENFields(strings.Fields(fields[0]))
+		if err != nil {
+			t.Fatalf("%s: %v", fields[0], err)
+		}
+		if seen[brd.hashKey] {
+			t.Errorf("%s: position written more than once", fields[0])
+		}
+		seen[brd.hashKey] = true
+		if brd.InCheck() {
+			t.Errorf("%s: side to move is in check", fields[0])
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			t.Errorf("%s: invalid score %q", fields[0], fields[1])
+		}
+		if result := fields[2]; result != "1.0" && result != "0.5" && result != "0.0" {
+			t.Errorf("%s: invalid result %q", fields[0], result)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) == 0 {
+		t.Error("expected positions to be written")
+	}
+}
+
+// Scores and results are given from white's point of view, whichever side is to move.
+func TestSelfPlayGame(t *testing.T) {
+	book := []*Board{ParseFENString("4k3/8/8/8/8/8/8/3QK3 w - - 0 1")}
+	w, htable := NewWorker(0), new(HistoryTable)
+	cfg := SelfPlayConfig{nodes: 5000}
+	positions, result := playSelfPlayGame(cfg, book, w, htable, rand.New(rand.NewSource(1)))
+	if result != 1.0 {
+		t.Errorf("expected white to win, got result %.1f", result)
+	}
+	sides := make(map[uint8]bool)
+	for _, pos := range positions {
+		if pos.score <= 0 {
+			t.Errorf("%s: expected a score favoring white, got %d", pos.fen, pos.score)
+		}
+		sides[ParseFENString(pos.fen).c] = true
+	}
+	if !sides[WHITE] || !sides[BLACK] {
+		t.Error("expected positions with each side to move")
+	}
+}
@@ -8,7 +8,7 @@ package main
 import "sort"
 
 // Root Sorting
-// At root, moves should be sorted based on subtree value rather than standard sorting.
+// At root, moves are sorted based on subtree size rather than standard sorting (see root.go).
 
 // bit pos. (LSB order)
 // 31  Winning promotions (1 bits)
@@ -16,7 +16,7 @@ import "sort"
 // 29  Losing promotions  (1 bits)
 // 28	 <<padding>> (1 bit)
 // 22  MVV/LVA  (6 bits)  - Used to choose between captures of equal material gain/loss
-// 0   History heuristic : (22 bits). Castles will always have the first bit set.
+// 0   History heuristic : (22 bits). Counter moves have bit 20 set. Castles will always have the first bit set.
 
 const (
 	SORT_WINNING_PROMOTION = (1 << 31)
@@ -17,6 +17,7 @@ type StackItem struct {
 	hashKey      uint64 // use hash key to search for repetitions
 	killers      KEntry
 	singularMove Move
+	prevMoves    [2]Move // the move leading to this node, and the move before that.
 
 	sp      *SplitPoint
 	pv      *PV
@@ -31,6 +32,7 @@ func (thisStk *StackItem) Copy() *StackItem {
 		pv:           thisStk.pv,
 		killers:      thisStk.killers,
 		singularMove: thisStk.singularMove,
+		prevMoves:    thisStk.prevMoves,
 		eval:         thisStk.eval,
 		hashKey:      thisStk.hashKey,
 		inCheck:      thisStk.inCheck,
@@ -43,6 +45,7 @@ func NewStack() Stack {
 	for i := 0; i < MAX_STACK; i++ {
 		stk[i].canNull = true
 		stk[i].singularMove = NO_MOVE
+		stk[i].prevMoves = [2]Move{NO_MOVE, NO_MOVE}
 	}
 	return stk
 }
@@ -0,0 +1,248 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Automatic tuning of evaluation parameters using the method described by Peter Österlund:
+// https://chessprogramming.wikispaces.com/Texel%27s+Tuning+Method
+
+// Given a set of positions labeled with the final result of the game they were taken from,
+// the quiescence score of each position is mapped to an expected result using a sigmoid
+// function. The tuner then searches for the set of parameters that minimizes the mean squared
+// difference between expected and actual results.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TuningPosition struct {
+	brd    *Board
+	result float64 // 1.0 for a white win, 0.5 for a draw, 0.0 for a black win.
+}
+
+type Tuner struct {
+	chunks  [][]TuningPosition // positions are split evenly between workers.
+	workers []*Worker
+	params  []EvalParam
+	k       float64 // scaling constant used to map centipawn scores to expected results.
+}
+
+func NewTuner(positions []TuningPosition, numWorkers int) *Tuner {
+	t := &Tuner{
+		chunks:  make([][]TuningPosition, numWorkers),
+		workers: make([]*Worker, numWorkers),
+		params:  evalParams(),
+		k:       1.0,
+	}
+	size := (len(positions) + numWorkers - 1) / numWorkers
+	for i := 0; i < numWorkers; i++ {
+		t.workers[i] = NewWorker(uint8(i))
+		start, end := min(i*size, len(positions)), min((i+1)*size, len(positions))
+		t.chunks[i] = positions[start:end]
+		for _, pos := range t.chunks[i] {
+			pos.brd.worker = t.workers[i]
+		}
+	}
+	return t
+}
+
+// meanSquaredError evaluates each position in parallel using the current evaluation parameters.
+func (t *Tuner) meanSquaredError(k float64) float64 {
+	var wg sync.WaitGroup
+	sums := make([]float64, len(t.chunks))
+	count := 0
+	for i, chunk := range t.chunks {
+		count += len(chunk)
+		wg.Add(1)
+		go func(i int, chunk []TuningPosition) {
+			defer wg.Done()
+			*t.workers[i].ptt = PawnTT{} // cached pawn structure and material scores may be out of date.
+			*t.workers[i].mtt = MaterialTT{}
+			s := &Search{}
+			for _, pos := range chunk {
+				err := pos.result - sigmoid(k, quietScore(s, pos.brd))
+				sums[i] += err * err
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	total := 0.0
+	for _, sum := range sums {
+		total += sum
+	}
+	return total / float64(max(count, 1))
+}
+
+// optimizeK finds the scaling constant that best fits the current evaluation to the game results.
+func (t *Tuner) optimizeK() {
+	best, bestError := t.k, t.meanSquaredError(t.k)
+	for step := 0.1; step >= 0.001; step /= 10 {
+		for _, dir := range [2]float64{1, -1} {
+			for k := best + dir*step; k > 0; k += dir * step {
+				err := t.meanSquaredError(k)
+				if err >= bestError {
+					break
+				}
+				best, bestError = k, err
+			}
+		}
+	}
+	t.k = best
+}
+
+// localSearch adjusts each parameter by one unit at a time, keeping any change that reduces the
+// error, until no further improvement is found or the iteration limit is reached. The current
+// parameters are written to outPath at the end of each iteration.
+func (t *Tuner) localSearch(iterations int, outPath string) error {
+	start := time.Now()
+	bestError := t.meanSquaredError(t.k)
+	fmt.Printf("K: %.3f, initial error: %.8f\n", t.k, bestError)
+
+	for iter := 1; iter <= iterations; iter++ {
+		improved := 0
+		for _, p := range t.params {
+			for i := 0; i < p.size; i++ {
+				original := p.get(i)
+				for _, delta := range [2]int{1, -1} {
+					p.set(i, original+delta)
+					setupEval()
+					if err := t.meanSquaredError(t.k); err < bestError {
+						bestError = err
+						improved++
+						break
+					}
+					p.set(i, original)
+					setupEval()
+				}
+			}
+		}
+		fmt.Printf("iteration %d: error %.8f, %d parameters improved (%.1fs)\n", iter, bestError,
+			improved, time.Since(start).Seconds())
+		if err := saveEvalParams(outPath); err != nil {
+			return err
+		}
+		if improved == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// quietScore returns the quiescence score of brd from white's point of view.
+func quietScore(s *Search, brd *Board) int {
+	refreshMaterial(brd)
+	stk := brd.worker.stk
+	stk[0].inCheck = brd.InCheck()
+	score, _ := s.quiescence(brd, stk, -INF, INF, 0, 0)
+	if brd.c == BLACK {
+		return -score
+	}
+	return score
+}
+
+func sigmoid(k float64, score int) float64 {
+	return 1.0 / (1.0 + math.Pow(10.0, -k*float64(score)/400.0))
+}
+
+// The material balance is normally updated incrementally. Since piece values and PSTs change
+// during tuning, it must be recalculated for each position before evaluation.
+func refreshMaterial(brd *Board) {
+	var sq int
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		brd.material[c] = 0
+		for pc := Piece(PAWN); pc < KING; pc++ {
+			for b := brd.pieces[c][pc]; b > 0; b.Clear(sq) {
+				sq = furthestForward(c, b)
+				brd.material[c] += materialScores[pc] + mainPst[c][pc][sq]
+			}
+		}
+	}
+}
+
+// loadTuningPositions reads one labeled position per line. Each line starts with a FEN string,
+// followed by the game result as 1-0, 0-1, 1/2-1/2 (optionally quoted, as in EPD files), or as
+// a bracketed decimal such as [1.0], [0.5] or [0.0].
+func loadTuningPositions(path string) ([]TuningPosition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var positions []TuningPosition
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			skipped++
+			continue
+		}
+		result, ok := parseGameResult(fields[4:])
+		if !ok {
+			skipped++
+			continue
+		}
+		brd, err := ParseFENFields(fields[:4])
+		if err != nil {
+			skipped++
+			continue
+		}
+		positions = append(positions, TuningPosition{brd, result})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		fmt.Printf("skipped %d lines without a valid FEN and result\n", skipped)
+	}
+	return positions, nil
+}
+
+func parseGameResult(fields []string) (float64, bool) {
+	for _, field := range fields {
+		str := strings.Trim(field, "\"[];,")
+		switch str {
+		case "1-0":
+			return 1.0, true
+		case "0-1":
+			return 0.0, true
+		case "1/2-1/2":
+			return 0.5, true
+		}
+		// only accept decimal results, to avoid confusing them with the FEN move counters.
+		if strings.Contains(str, ".") {
+			if result, err := strconv.ParseFloat(str, 64); err == nil && result >= 0 && result <= 1 {
+				return result, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// RunTuner tunes the evaluation parameters against the labeled positions at positionsPath and
+// writes the tuned parameters to outPath.
+func RunTuner(positionsPath, outPath string, numWorkers, iterations int) error {
+	positions, err := loadTuningPositions(positionsPath)
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		return fmt.Errorf("no labeled positions found in %s", positionsPath)
+	}
+	t := NewTuner(positions, max(numWorkers, 1))
+	fmt.Printf("Tuning %d parameters against %d positions using %d workers\n",
+		paramCount(t.params), len(positions), len(t.workers))
+	t.optimizeK()
+	return t.localSearch(iterations, outPath)
+}
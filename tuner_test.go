@@ -0,0 +1,92 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A single iteration of local search should adjust at least one parameter, and the parameters it
+// writes out should load back unchanged. Positions that fail FEN validation are skipped.
+func TestTunerIteration(t *testing.T) {
+	dir := t.TempDir()
+	// local search changes the global evaluation parameters; restore them once the test is done.
+	original := filepath.Join(dir, "original.txt")
+	if err := saveEvalParams(original); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := loadEvalParams(original); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	positionsPath := filepath.Join(dir, "positions.txt")
+	labeled := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 1/2-1/2\n" +
+		"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 1-0\n" +
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 1-0\n" +
+		"4k3/8/8/8/8/8/8/R3K3 b - - 1-0\n" +
+		"6k1/5ppp/8/8/8/8/r4PPP/6K1 w - - 0-1\n" +
+		"8/8/4k3/8/8/3BK3/8/8 w - - 1/2-1/2\n" +
+		"4k3/8/8/8/8/8/8/4R1K1 w - - 1-0\n"
+	if err := os.WriteFile(positionsPath, []byte(labeled), 0644); err != nil {
+		t.Fatal(err)
+	}
+	positions, err := loadTuningPositions(positionsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 6 {
+		t.Fatalf("expected 6 labeled positions, got %d", len(positions))
+	}
+
+	initial := paramValues()
+	tuner := NewTuner(positions, 2)
+	tuner.optimizeK()
+	paramsPath := filepath.Join(dir, "params.txt")
+	if err := tuner.localSearch(1, paramsPath); err != nil {
+		t.Fatal(err)
+	}
+	tuned := paramValues()
+	if !changed(initial, tuned) {
+		t.Fatal("expected local search to change at least one parameter")
+	}
+
+	if err := loadEvalParams(original); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadEvalParams(paramsPath); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := paramValues(); changed(tuned, loaded) {
+		t.Error("expected the saved parameters to load back to the tuned values")
+	}
+}
+
+func paramValues() [][]int {
+	var values [][]int
+	for _, p := range evalParams() {
+		weights := make([]int, p.size)
+		for i := range weights {
+			weights[i] = p.get(i)
+		}
+		values = append(values, weights)
+	}
+	return values
+}
+
+func changed(a, b [][]int) bool {
+	for i := range a {
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return true
+			}
+		}
+	}
+	return false
+}
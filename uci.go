@@ -14,10 +14,13 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -26,19 +29,36 @@ import (
 
 // Info
 type Info struct {
-	score, depth, nodeCount int
-	t                       time.Duration // time elapsed
-	stk                     Stack
+	score, depth, selDepth, nodeCount int
+	t                                 time.Duration // time elapsed
+	pv                                *PV
+	bound                             string // "lowerbound" or "upperbound" if the score is not exact.
+	multiPV                           int    // the number of the line when several are requested, otherwise 0.
+	hashfull                          int    // permille of the hash table used by the current search.
 }
 
-// TODO: add proper error handling in UCI adapter.
+// The adapter is always in one of three states. While searching, the best move is sent as soon
+// as the search finishes. While pondering, the best move is held until the GUI sends ponderhit
+// or stop, even if the search finishes first.
+type UCIState int
+
+const (
+	UCI_IDLE UCIState = iota
+	UCI_SEARCHING
+	UCI_PONDERING
+)
+
 type UCIAdapter struct {
-	brd    *Board
+	game   *GameState // the position set up by the GUI, and the moves leading to it.
 	search *Search
-	wg     *sync.WaitGroup
 	result chan SearchResult
+	out    io.Writer
+	outMu  sync.Mutex // output is sent from both the command loop and the search goroutine.
 
-	moveCounter int
+	state        UCIState
+	ponderResult *SearchResult // set if a ponder search finished before ponderhit or stop.
+	moveCounter  int
+	htable       *HistoryTable // move ordering history, kept between searches until ucinewgame.
 
 	optionPonder bool
 	optionDebug  bool
@@ -46,14 +66,18 @@ type UCIAdapter struct {
 
 func NewUCIAdapter() *UCIAdapter {
 	return &UCIAdapter{
-		wg:     new(sync.WaitGroup),
+		game:   NewGameState(StartPos()),
 		result: make(chan SearchResult),
+		out:    os.Stdout,
+		htable: new(HistoryTable),
 	}
 }
 
 func (uci *UCIAdapter) Send(s string) { // log the UCI command s and print to standard I/O.
-	log.Printf("engine: " + s)
-	fmt.Print(s)
+	uci.outMu.Lock()
+	defer uci.outMu.Unlock()
+	log.Print("engine: " + s)
+	fmt.Fprint(uci.out, s)
 }
 
 func (uci *UCIAdapter) BestMove(result SearchResult) {
@@ -63,11 +87,38 @@ func (uci *UCIAdapter) BestMove(result SearchResult) {
 
 // Printed to standard output at end of each non-trivial iterative deepening pass.
 // Score given in centipawns. Time given in milliseconds. PV given as list of moves.
-// Example: info score cp 13  depth 1 nodes 13 time 15 pv f1b5 h1h2
+// Example: info score cp 13 depth 1 seldepth 3 nodes 13 nps 866 hashfull 0 time 15 pv f1b5 h1h2
 func (uci *UCIAdapter) Info(info Info) {
 	nps := int64(float64(info.nodeCount) / info.t.Seconds())
-	uci.Send(fmt.Sprintf("info score cp %d depth %d nodes %d nps %d time %d pv %s\n", info.score,
-		info.depth, info.nodeCount, nps, int(info.t/time.Millisecond), info.stk[0].pv.ToUCI()))
+	line := ""
+	if info.multiPV > 0 {
+		line = fmt.Sprintf("multipv %d ", info.multiPV)
+	}
+	score := fmt.Sprintf("score cp %d", info.score)
+	if info.bound != "" {
+		score += " " + info.bound
+	}
+	stats := fmt.Sprintf("depth %d seldepth %d nodes %d nps %d hashfull %d time %d", info.depth,
+		info.selDepth, info.nodeCount, nps, info.hashfull, int(info.t/time.Millisecond))
+	if info.bound != "" { // the PV is incomplete when the score is outside the aspiration window.
+		uci.Send(fmt.Sprintf("info %s%s %s\n", line, score, stats))
+		return
+	}
+	uci.Send(fmt.Sprintf("info %s%s %s pv %s\n", line, score, stats, info.pv.ToUCI()))
+}
+
+// Sent periodically while searching, so the GUI can show progress during long iterations.
+// Example: info nodes 1520344 nps 1520114 hashfull 87 time 1000
+func (uci *UCIAdapter) Progress(nodes, hashfull int, t time.Duration) {
+	nps := int64(float64(nodes) / t.Seconds())
+	uci.Send(fmt.Sprintf("info nodes %d nps %d hashfull %d time %d\n", nodes, nps, hashfull,
+		int(t/time.Millisecond)))
+}
+
+// Sent before searching each root move once the search has run for a while.
+// Example: info depth 12 currmove e2e4 currmovenumber 1
+func (uci *UCIAdapter) CurrMove(depth int, m Move, number int) {
+	uci.Send(fmt.Sprintf("info depth %d currmove %s currmovenumber %d\n", depth, m.ToUCI(), number))
 }
 
 func (uci *UCIAdapter) InfoString(s string) {
@@ -75,9 +126,6 @@ func (uci *UCIAdapter) InfoString(s string) {
 }
 
 func (uci *UCIAdapter) Read(reader *bufio.Reader) {
-	var input string
-	var uciFields []string
-
 	f, err := os.OpenFile("./log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
 	if err != nil {
 		fmt.Printf("info string error opening file: %v\n", err)
@@ -92,169 +140,290 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 	defer f.Close()
 	log.SetOutput(f)
 
-	ponder := false
+	uci.ReadCommands(reader)
+}
 
-	for {
-		input, _ = reader.ReadString('\n')
-		log.Println("gui: " + input)
-		uciFields = strings.Fields(input)
-
-		if len(uciFields) > 0 {
-			switch uciFields[0] {
-			case "":
-				continue
-				// uci
-				// 	tell engine to use the uci (universal chess interface),
-				// 	this will be send once as a first command after program boot
-				// 	to tell the engine to switch to uci mode.
-				// 	After receiving the uci command the engine must identify itself with the "id" command
-				// 	and sent the "option" commands to tell the GUI which engine settings the engine supports if any.
-				// 	After that the engine should sent "uciok" to acknowledge the uci mode.
-				// 	If no uciok is sent within a certain time period, the engine task will be killed by the GUI.
-			case "uci":
-				uci.identify()
-				// * debug [ on | off ]
-				// 	switch the debug mode of the engine on and off.
-				// 	In debug mode the engine should sent additional infos to the GUI, e.g. with the "info string" command,
-				// 	to help debugging, e.g. the commands that the engine has received etc.
-				// 	This mode should be switched off by default and this command can be sent
-				// 	any time, also when the engine is thinking.
-			case "debug":
-				if len(uciFields) > 1 {
-					uci.optionDebug = uci.debug(uciFields[1:])
-				}
-				uci.Send("readyok\n")
-				// * isready
-				// 	this is used to synchronize the engine with the GUI. When the GUI has sent a command or
-				// 	multiple commands that can take some time to complete,
-				// 	this command can be used to wait for the engine to be ready again or
-				// 	to ping the engine to find out if it is still alive.
-				// 	E.g. this should be sent after setting the path to the tablebases as this can take some time.
-				// 	This command is also required once before the engine is asked to do any search
-				// 	to wait for the engine to finish initializing.
-				// 	This command must always be answered with "readyok" and can be sent also when the engine is calculating
-				// 	in which case the engine should also immediately answer with "readyok" without stopping the search.
-			case "isready":
-				uci.wg.Wait()
-				uci.Send("readyok\n")
-				// * setoption name  [value ]
-				// 	this is sent to the engine when the user wants to change the internal parameters
-				// 	of the engine. For the "button" type no value is needed.
-				// 	One string will be sent for each parameter and this will only be sent when the engine is waiting.
-				// 	The name of the option in  should not be case sensitive and can inludes spaces like also the value.
-				// 	The substrings "value" and "name" should be avoided in  and  to allow unambiguous parsing,
-				// 	for example do not use  = "draw value".
-				// 	Here are some strings for the example below:
-				// 	   "setoption name Nullmove value true\n"
-				//       "setoption name Selectivity value 3\n"
-				// 	   "setoption name Style value Risky\n"
-				// 	   "setoption name Clear Hash\n"
-				// 	   "setoption name NalimovPath value c:\chess\tb\4;c:\chess\tb\5\n"
-			case "setoption": // setoption name option_name
-				if len(uciFields) > 2 && uciFields[1] == "name" {
-					uci.setOption(uciFields[2:])
-				}
-				uci.Send("readyok\n")
-				// * register
-				// 	this is the command to try to register an engine or to tell the engine that registration
-				// 	will be done later. This command should always be sent if the engine	has send "registration error"
-				// 	at program startup.
-				// 	The following tokens are allowed:
-				// 	* later
-				// 	   the user doesn't want to register the engine now.
-				// 	* name
-				// 	   the engine should be registered with the name
-				// 	* code
-				// 	   the engine should be registered with the code
-				// 	Example:
-				// 	   "register later"
-				// 	   "register name Stefan MK code 4359874324"
-				//
-			case "register":
-				if len(uciFields) > 1 {
-					uci.register(uciFields[1:])
-				}
-				uci.Send("readyok\n")
-				// * ucinewgame
-				//    this is sent to the engine when the next search (started with "position" and "go") will be from
-				//    a different game. This can be a new game the engine should play or a new game it should analyse but
-				//    also the next position from a testsuite with positions only.
-				//    If the GUI hasn't sent a "ucinewgame" before the first "position" command, the engine shouldn't
-				//    expect any further ucinewgame commands as the GUI is probably not supporting the ucinewgame command.
-				//    So the engine should not rely on this command even though all new GUIs should support it.
-				//    As the engine's reaction to "ucinewgame" can take some time the GUI should always send "isready"
-				//    after "ucinewgame" to wait for the engine to finish its operation.
-			case "ucinewgame":
-				resetMainTt()
-				uci.brd = StartPos()
-				uci.Send("readyok\n")
-				// * position [fen  | startpos ]  moves  ....
-				// 	set up the position described in fenstring on the internal board and
-				// 	play the moves on the internal chess board.
-				// 	if the game was played  from the start position the string "startpos" will be sent
-				// 	Note: no "new" command is needed. However, if this position is from a different game than
-				// 	the last position sent to the engine, the GUI should have sent a "ucinewgame" inbetween.
-			case "position":
-				uci.wg.Wait()
-				uci.position(uciFields[1:])
-				uci.Send("readyok\n")
-				// * go
-				// 	start calculating on the current position set up with the "position" command.
-				// 	There are a number of commands that can follow this command, all will be sent in the same string.
-				// 	If one command is not send its value should be interpreted as it would not influence the search.
-			case "go":
-				if uci.brd != nil {
-					ponder = uci.start(uciFields[1:]) // parse any parameters given by GUI and begin searching.
-					if !uci.optionPonder || !ponder {
-						uci.moveCounter++
-					}
-				} else {
-					uci.InfoString("You must set the current position via the position command before searching.\n")
-				}
-				// * stop
-				// 	stop calculating as soon as possible,
-				// 	don't forget the "bestmove" and possibly the "ponder" token when finishing the search
-			case "stop": // stop calculating and return a result as soon as possible.
-				if uci.search != nil {
-					uci.search.Abort()
-					if ponder {
-						uci.BestMove(<-uci.result)
-					}
+// ReadCommands processes commands from the GUI until "quit" is received or the input is closed.
+// Input is read on a separate goroutine, so that commands such as isready and stop are handled
+// immediately while a search is running.
+func (uci *UCIAdapter) ReadCommands(reader *bufio.Reader) {
+	commands, done := make(chan string), make(chan bool)
+	defer close(done)
+	go func() {
+		for {
+			input, err := reader.ReadString('\n')
+			if input != "" {
+				select {
+				case commands <- input:
+				case <-done:
+					return
 				}
-				// * ponderhit
-				// 	the user has played the expected move. This will be sent if the engine was told to ponder on the same move
-				// 	the user has played. The engine should continue searching but switch from pondering to normal search.
-			case "ponderhit":
-				if uci.search != nil && ponder {
-					uci.search.gt.Start()
-					uci.BestMove(<-uci.result)
-				}
-				uci.moveCounter++
-			case "quit": // quit the program as soon as possible
+			}
+			if err != nil {
+				close(commands)
 				return
-
-			case "print": // Not a UCI command. Used to print the board for debugging from console
-				uci.brd.Print() // while in UCI mode.
-			default:
-				uci.invalid(uciFields)
 			}
 		}
+	}()
+	for {
+		select {
+		case input, ok := <-commands:
+			if !ok || !uci.Execute(input) {
+				uci.abortSearch()
+				return
+			}
+		case result := <-uci.result:
+			uci.searchFinished(result)
+		}
 	}
 }
 
-func (uci *UCIAdapter) debug(uciFields []string) bool {
-	switch uciFields[0] {
-	case "on":
+var uciCommands = map[string]bool{"uci": true, "debug": true, "isready": true, "setoption": true,
+	"register": true, "ucinewgame": true, "position": true, "go": true, "stop": true,
+	"ponderhit": true, "quit": true, "print": true, "perft": true, "divide": true}
+
+// These commands are only accepted while the engine is idle.
+var uciIdleCommands = map[string]bool{"setoption": true, "ucinewgame": true, "go": true,
+	"perft": true, "divide": true}
+
+// Execute carries out a single command from the GUI, reporting any errors via info string.
+// Returns false if the engine should quit.
+func (uci *UCIAdapter) Execute(input string) bool {
+	log.Println("gui: " + input)
+	tk := NewUCITokenizer(input)
+	// Unknown tokens preceding a command are skipped, as required by the UCI specification.
+	for !tk.Done() && !uciCommands[tk.Peek()] {
+		tk.Next()
+	}
+	if tk.Done() {
+		if strings.TrimSpace(input) != "" {
+			uci.InfoString(fmt.Sprintf("unknown command: %s\n", strings.TrimSpace(input)))
+		}
 		return true
-	case "off":
-	default:
-		uci.invalid(uciFields)
 	}
-	return false
+	var err error
+	command := tk.Next()
+	if uci.state != UCI_IDLE && uciIdleCommands[command] {
+		uci.InfoString(fmt.Sprintf("%s: not allowed while searching\n", command))
+		return true
+	}
+	switch command {
+	// uci
+	// 	tell engine to use the uci (universal chess interface),
+	// 	this will be send once as a first command after program boot
+	// 	to tell the engine to switch to uci mode.
+	// 	After receiving the uci command the engine must identify itself with the "id" command
+	// 	and sent the "option" commands to tell the GUI which engine settings the engine supports if any.
+	// 	After that the engine should sent "uciok" to acknowledge the uci mode.
+	// 	If no uciok is sent within a certain time period, the engine task will be killed by the GUI.
+	case "uci":
+		uci.identify()
+		// * debug [ on | off ]
+		// 	switch the debug mode of the engine on and off.
+		// 	In debug mode the engine should sent additional infos to the GUI, e.g. with the "info string" command,
+		// 	to help debugging, e.g. the commands that the engine has received etc.
+		// 	This mode should be switched off by default and this command can be sent
+		// 	any time, also when the engine is thinking.
+	case "debug":
+		err = uci.debug(tk)
+		// * isready
+		// 	this is used to synchronize the engine with the GUI. When the GUI has sent a command or
+		// 	multiple commands that can take some time to complete,
+		// 	this command can be used to wait for the engine to be ready again or
+		// 	to ping the engine to find out if it is still alive.
+		// 	E.g. this should be sent after setting the path to the tablebases as this can take some time.
+		// 	This command is also required once before the engine is asked to do any search
+		// 	to wait for the engine to finish initializing.
+		// 	This command must always be answered with "readyok" and can be sent also when the engine is calculating
+		// 	in which case the engine should also immediately answer with "readyok" without stopping the search.
+	case "isready":
+		uci.Send("readyok\n")
+		// * setoption name  [value ]
+		// 	this is sent to the engine when the user wants to change the internal parameters
+		// 	of the engine. For the "button" type no value is needed.
+		// 	One string will be sent for each parameter and this will only be sent when the engine is waiting.
+		// 	The name of the option in  should not be case sensitive and can inludes spaces like also the value.
+		// 	The substrings "value" and "name" should be avoided in  and  to allow unambiguous parsing,
+		// 	for example do not use  = "draw value".
+		// 	Here are some strings for the example below:
+		// 	   "setoption name Nullmove value true\n"
+		//       "setoption name Selectivity value 3\n"
+		// 	   "setoption name Style value Risky\n"
+		// 	   "setoption name Clear Hash\n"
+		// 	   "setoption name NalimovPath value c:\chess\tb\4;c:\chess\tb\5\n"
+	case "setoption":
+		err = uci.setOption(tk)
+		// * register
+		// 	this is the command to try to register an engine or to tell the engine that registration
+		// 	will be done later. This command should always be sent if the engine	has send "registration error"
+		// 	at program startup.
+		// 	The following tokens are allowed:
+		// 	* later
+		// 	   the user doesn't want to register the engine now.
+		// 	* name
+		// 	   the engine should be registered with the name
+		// 	* code
+		// 	   the engine should be registered with the code
+		// 	Example:
+		// 	   "register later"
+		// 	   "register name Stefan MK code 4359874324"
+		//
+	case "register":
+		uci.register(tk)
+		// * ucinewgame
+		//    this is sent to the engine when the next search (started with "position" and "go") will be from
+		//    a different game. This can be a new game the engine should play or a new game it should analyse but
+		//    also the next position from a testsuite with positions only.
+		//    If the GUI hasn't sent a "ucinewgame" before the first "position" command, the engine shouldn't
+		//    expect any further ucinewgame commands as the GUI is probably not supporting the ucinewgame command.
+		//    So the engine should not rely on this command even though all new GUIs should support it.
+		//    As the engine's reaction to "ucinewgame" can take some time the GUI should always send "isready"
+		//    after "ucinewgame" to wait for the engine to finish its operation.
+	case "ucinewgame":
+		resetMainTt()
+		uci.moveCounter = 0
+		uci.htable.Clear()
+		loadBalancer.ClearKillers()
+		uci.game = NewGameState(StartPos())
+		// * position [fen  | startpos ]  moves  ....
+		// 	set up the position described in fenstring on the internal board and
+		// 	play the moves on the internal chess board.
+		// 	if the game was played  from the start position the string "startpos" will be sent
+		// 	Note: no "new" command is needed. However, if this position is from a different game than
+		// 	the last position sent to the engine, the GUI should have sent a "ucinewgame" inbetween.
+	case "position": // the search runs on its own copy of the board, so this needn't wait.
+		err = uci.position(tk)
+		// * go
+		// 	start calculating on the current position set up with the "position" command.
+		// 	There are a number of commands that can follow this command, all will be sent in the same string.
+		// 	If one command is not send its value should be interpreted as it would not influence the search.
+	case "go":
+		if err = uci.start(tk); err == nil && uci.state != UCI_PONDERING {
+			uci.moveCounter++
+		}
+		// * stop
+		// 	stop calculating as soon as possible,
+		// 	don't forget the "bestmove" and possibly the "ponder" token when finishing the search
+	case "stop": // stop calculating and return a result as soon as possible.
+		uci.stop()
+		// * ponderhit
+		// 	the user has played the expected move. This will be sent if the engine was told to ponder on the same move
+		// 	the user has played. The engine should continue searching but switch from pondering to normal search.
+	case "ponderhit":
+		uci.ponderhit()
+	case "quit": // quit the program as soon as possible
+		return false
+
+	case "print": // Not a UCI command. Used to print the board for debugging from console
+		uci.game.brd.Print() // while in UCI mode.
+		// * perft | divide depth [threads n] [hash mb]
+		//   Not UCI commands. Used to debug move generation from console. Counts the leaf nodes
+		//   of the legal move tree below the current position, and for divide, below each root move.
+	case "perft", "divide":
+		err = uci.perft(command, tk)
+	}
+	if err != nil {
+		uci.InfoString(fmt.Sprintf("%s: %v\n", command, err))
+	}
+	return true
+}
+
+func (uci *UCIAdapter) searchFinished(result SearchResult) {
+	switch uci.state {
+	case UCI_SEARCHING:
+		uci.BestMove(result)
+		uci.state = UCI_IDLE
+	case UCI_PONDERING:
+		uci.ponderResult = &result
+	}
+}
+
+func (uci *UCIAdapter) stop() {
+	switch {
+	case uci.state == UCI_IDLE:
+	case uci.ponderResult != nil:
+		uci.BestMove(*uci.ponderResult)
+		uci.state = UCI_IDLE
+	default: // the result is sent once the search returns.
+		uci.search.Abort()
+		uci.state = UCI_SEARCHING
+	}
+}
+
+func (uci *UCIAdapter) ponderhit() {
+	if uci.state == UCI_PONDERING {
+		if uci.ponderResult != nil {
+			uci.BestMove(*uci.ponderResult)
+			uci.state = UCI_IDLE
+		} else {
+			uci.search.gt.Start()
+			uci.state = UCI_SEARCHING
+		}
+	}
+	uci.moveCounter++
+}
+
+// abortSearch stops any running search and waits for it to return, without sending a result.
+func (uci *UCIAdapter) abortSearch() {
+	if uci.state != UCI_IDLE && uci.ponderResult == nil {
+		uci.search.Abort()
+		<-uci.result
+	}
+	uci.state = UCI_IDLE
 }
 
-func (uci *UCIAdapter) invalid(uciFields []string) {
-	uci.InfoString("invalid command.\n")
+func (uci *UCIAdapter) perft(command string, tk *UCITokenizer) error {
+	depth, err := tk.Int("depth", 1)
+	if err != nil {
+		return err
+	}
+	threads, hashSize := len(loadBalancer.workers), 0
+	for !tk.Done() {
+		switch param := tk.Next(); param {
+		case "threads":
+			threads, err = tk.Int(param, 1)
+		case "hash":
+			hashSize, err = tk.Int(param, 1)
+		default:
+			err = fmt.Errorf("unknown parameter %q", param)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var tt *PerftTT
+	if hashSize > 0 {
+		tt = NewPerftTT(hashSize)
+	}
+	start := time.Now()
+	results := Divide(uci.game.brd, depth, threads, tt)
+	elapsed := time.Since(start)
+	// moves are listed in the same order as other engines, to simplify comparison.
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].move.ToUCI() < results[j].move.ToUCI()
+	})
+	var sum int
+	for _, result := range results {
+		if command == "divide" {
+			uci.Send(fmt.Sprintf("%s: %d\n", result.move.ToUCI(), result.nodes))
+		}
+		sum += result.nodes
+	}
+	nps := int64(float64(sum) / elapsed.Seconds())
+	uci.Send(fmt.Sprintf("\nnodes %d time %d nps %d\n", sum, int(elapsed/time.Millisecond), nps))
+	return nil
+}
+
+func (uci *UCIAdapter) debug(tk *UCITokenizer) error {
+	switch arg := tk.Next(); arg {
+	case "on":
+		uci.optionDebug = true
+	case "off":
+		uci.optionDebug = false
+	default:
+		return fmt.Errorf("expected on or off, got %q", arg)
+	}
+	return nil
 }
 
 func (uci *UCIAdapter) identify() {
@@ -269,6 +438,13 @@ func (uci *UCIAdapter) option() { // option name option_name [ parameters ]
 	uci.Send("option name Ponder type check default false\n")
 	numCPU := runtime.NumCPU()
 	uci.Send(fmt.Sprintf("option name CPU type spin default %d min 1 max %d\n", numCPU, numCPU))
+	uci.Send("option name UseNNUE type check default false\n")
+	uci.Send("option name EvalFile type string default <empty>\n")
+	uci.Send("option name UCI_Chess960 type check default false\n")
+	uci.Send("option name Clear Hash type button\n")
+	for _, opt := range searchOptions {
+		uci.Send(opt.String())
+	}
 }
 
 // some example options from Toga 1.3.1:
@@ -303,39 +479,59 @@ func (uci *UCIAdapter) option() { // option name option_name [ parameters ]
 // Engine: option name Toga King Safety Margin type spin default 1700 min 500 max 3000
 // Engine: option name Toga Extended History Pruning type check default false
 
-func (uci *UCIAdapter) setOption(uciFields []string) {
-	switch uciFields[0] {
-	case "Ponder": // example: setoption name Ponder value true
-		if len(uciFields) == 3 {
-			switch uciFields[2] {
-			case "true":
-				uci.optionPonder = true
-			case "false":
-				uci.optionPonder = false
-			default:
-				uci.invalid(uciFields)
-			}
-		}
+// Option names are matched case-insensitively, and may contain spaces like their values.
+func (uci *UCIAdapter) setOption(tk *UCITokenizer) error {
+	name, value, err := tk.ParseOption()
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(name) {
+	case "ponder": // example: setoption name Ponder value true
+		uci.optionPonder, err = parseCheck(name, value)
 		// option name CPU type spin default 0 min 1 max numCPU
-	case "CPU":
-		if len(uciFields) == 3 {
-			numCPU, err := strconv.Atoi(uciFields[2])
-			if err != nil {
-				uci.invalid(uciFields)
-				return
-			}
-			if numCPU > 0 && runtime.NumCPU() >= numCPU {
-				if uci.optionDebug {
-					uci.InfoString(fmt.Sprintf("setting up load balancer for %d CPU\n", numCPU))
-				}
-				setupLoadBalancer(numCPU)
-			}
+	case "cpu":
+		numCPU, convErr := strconv.Atoi(value)
+		if convErr != nil || numCPU < 1 || numCPU > runtime.NumCPU() {
+			return fmt.Errorf("invalid value %q for %s, expected 1 to %d", value, name, runtime.NumCPU())
+		}
+		if uci.optionDebug {
+			uci.InfoString(fmt.Sprintf("setting up load balancer for %d CPU\n", numCPU))
+		}
+		setupLoadBalancer(numCPU)
+		// option name UseNNUE type check default false
+	case "usennue":
+		useNNUE, err = parseCheck(name, value)
+		// option name UCI_Chess960 type check default false
+	case "uci_chess960":
+		uciChess960, err = parseCheck(name, value)
+		// option name EvalFile type string default <empty>
+	case "evalfile": // example: setoption name EvalFile value nets/gopher.nnue
+		if value == "" {
+			return fmt.Errorf("missing value for %s", name)
+		}
+		net, loadErr := LoadNetwork(value)
+		if loadErr != nil {
+			return fmt.Errorf("could not load network: %v", loadErr)
 		}
+		nnueNetwork = net
+		if uci.optionDebug {
+			uci.InfoString(fmt.Sprintf("loaded network with %d hidden neurons\n", net.hiddenSize))
+		}
+		// option name Clear Hash type button
+	case "clear hash":
+		resetMainTt()
 	default:
+		for _, opt := range searchOptions {
+			if strings.EqualFold(name, opt.name) {
+				return opt.Set(value)
+			}
+		}
+		return fmt.Errorf("unknown option %q", name)
 	}
+	return err
 }
 
-func (uci *UCIAdapter) register(uciFields []string) {
+func (uci *UCIAdapter) register(tk *UCITokenizer) {
 	// The following tokens are allowed:
 	// * later - the user doesn't want to register the engine now.
 	// * name - the engine should be registered with the name
@@ -347,25 +543,30 @@ func (uci *UCIAdapter) register(uciFields []string) {
 // 	start calculating on the current position set up with the "position" command.
 // 	There are a number of commands that can follow this command, all will be sent in the same string.
 // 	If one command is not send its value should be interpreted as it would not influence the search.
-func (uci *UCIAdapter) start(uciFields []string) bool {
-	var timeLimit int
+// The search is only started once all parameters have been verified.
+func (uci *UCIAdapter) start(tk *UCITokenizer) error {
+	var n, nodeLimit int
+	var err error
 	maxDepth := MAX_DEPTH
-	gt := NewGameTimer(uci.moveCounter, uci.brd.c) // TODO: this will be inaccurate in pondering mode.
+	gt := NewGameTimer(uci.moveCounter, uci.game.brd.c) // when pondering, the clock is started on ponderhit.
 	ponder := false
 	var allowedMoves []Move
-	for len(uciFields) > 0 {
-		// fmt.Println(uci_fields[0])
-		switch uciFields[0] {
+	restricted := false
+	for !tk.Done() {
+		switch param := tk.Next(); param {
 
 		// 	* searchmoves  ....
 		// 		restrict search to this moves only
 		// 		Example: After "position startpos" and "go infinite searchmoves e2e4 d2d4"
 		// 		the engine should only search the two moves e2e4 and d2d4 in the initial position.
 		case "searchmoves":
-			uciFields = uciFields[1:]
-			for len(uciFields) > 0 && IsMove(uciFields[0]) {
-				allowedMoves = append(allowedMoves, ParseMove(uci.brd, uciFields[0]))
-				uciFields = uciFields[1:]
+			restricted = true
+			for IsMove(tk.Peek()) {
+				if m, err := ParseLegalMove(uci.game.brd, tk.Next()); err == nil {
+					allowedMoves = append(allowedMoves, m)
+				} else {
+					uci.InfoString(fmt.Sprintf("ignoring searchmoves entry: %v\n", err))
+				}
 			}
 
 		// 	* ponder - start searching in pondering mode.
@@ -373,101 +574,117 @@ func (uci *UCIAdapter) start(uciFields []string) bool {
 			if uci.optionPonder {
 				ponder = true
 			}
-			uciFields = uciFields[1:]
 
+		// some GUIs send negative times once the clock has run out, so these are clamped to zero.
 		case "wtime": // white has x msec left on the clock
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.remaining[WHITE] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
+			n, err = tk.Int(param, math.MinInt32)
+			gt.remaining[WHITE] = time.Duration(max(n, 0)) * time.Millisecond
 
 		case "btime": // black has x msec left on the clock
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.remaining[BLACK] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
+			n, err = tk.Int(param, math.MinInt32)
+			gt.remaining[BLACK] = time.Duration(max(n, 0)) * time.Millisecond
 
 		case "winc": //	white increment per move in mseconds if x > 0
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.inc[WHITE] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
+			n, err = tk.Int(param, 0)
+			gt.inc[WHITE] = time.Duration(n) * time.Millisecond
 
 		case "binc": //	black increment per move in mseconds if x > 0
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.inc[BLACK] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
+			n, err = tk.Int(param, 0)
+			gt.inc[BLACK] = time.Duration(n) * time.Millisecond
 
 		// 	* movestogo: there are x moves to the next time control, this will only be sent if x > 0,
 		// 		if you don't get this and get the wtime and btime it's sudden death
 		case "movestogo":
-			remaining, _ := strconv.Atoi(uciFields[1])
-			gt.movesRemaining = remaining
-			uciFields = uciFields[2:]
+			gt.movesToGo, err = tk.Int(param, 1)
 
 		case "depth": // search x plies only
-			maxDepth, _ = strconv.Atoi(uciFields[1])
-			uciFields = uciFields[2:]
+			maxDepth, err = tk.Int(param, 1)
+			maxDepth = min(maxDepth, MAX_DEPTH)
 
 		case "nodes": // search x nodes only
-			uci.invalid(uciFields)
-			uciFields = uciFields[2:]
+			nodeLimit, err = tk.Int(param, 1)
 
 		case "mate": // search for a mate in x moves
-			uci.invalid(uciFields)
-			uciFields = uciFields[2:]
+			if _, err = tk.Int(param, 1); err == nil {
+				uci.InfoString("mate search is not supported, searching normally.\n")
+			}
 
 		case "movetime": // search exactly x mseconds
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.SetMoveTime(time.Duration(timeLimit) * time.Millisecond)
-			uciFields = uciFields[2:]
+			n, err = tk.Int(param, 0)
+			gt.SetMoveTime(time.Duration(n) * time.Millisecond)
 		// * infinite: search until the "stop" command. Do not exit the search without being
 		// told so in this mode!
 		case "infinite":
 			gt.SetMoveTime(MAX_TIME)
-			uciFields = uciFields[1:]
 		default:
-			uciFields = uciFields[1:]
+			err = fmt.Errorf("unknown parameter %q", param)
 		}
+		if err != nil {
+			return err
+		}
+	}
+	// searching all moves would let the engine answer with a move the GUI excluded.
+	if restricted && len(allowedMoves) == 0 {
+		return fmt.Errorf("no legal moves given for searchmoves")
+	}
+	uci.state, uci.ponderResult = UCI_SEARCHING, nil
+	if ponder {
+		uci.state = UCI_PONDERING
 	}
-	uci.wg.Add(1)
 
 	// type SearchParams struct {
 	// 	max_depth         int
 	// 	verbose, ponder, restrict_search bool
 	// }
-	uci.search = NewSearch(SearchParams{maxDepth, uci.optionDebug, ponder, len(allowedMoves) > 0},
-		gt, uci, allowedMoves)
-	go uci.search.Start(uci.brd.Copy()) // starting the search also starts the clock
-	return ponder
+	uci.search = NewSearch(SearchParams{maxDepth, uci.optionDebug, ponder},
+		gt, uci, uci.htable, allowedMoves)
+	uci.search.nodeLimit, uci.search.history = nodeLimit, uci.game.history
+	go uci.search.Start(uci.game.brd.Copy()) // starting the search also starts the clock
+	return nil
 }
 
 // position [fen  | startpos ]  moves  ....
-func (uci *UCIAdapter) position(uciFields []string) {
-	if len(uciFields) == 0 {
-		uci.brd = StartPos()
-	} else if uciFields[0] == "startpos" {
-		uci.brd = StartPos()
-		uciFields = uciFields[1:]
-		if len(uciFields) > 1 && uciFields[0] == "moves" {
-			uci.playMoveSequence(uciFields[1:])
+// The position is only updated once the FEN and all moves have been verified. Otherwise, the
+// error is reported and the previous position is kept.
+func (uci *UCIAdapter) position(tk *UCITokenizer) error {
+	var brd *Board
+	switch arg := tk.Next(); arg {
+	case "startpos":
+		brd = StartPos()
+	case "fen":
+		var err error
+		if brd, err = ParseFENFields(strings.Fields(tk.NextUntil("moves"))); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("expected startpos or fen, got %q", arg)
+	}
+	gs := NewGameState(brd)
+	if !tk.Done() {
+		if arg := tk.Next(); arg != "moves" {
+			return fmt.Errorf("expected moves, got %q", arg)
 		}
-	} else if uciFields[0] == "fen" {
-		uci.brd = ParseFENSlice(uciFields[1:])
-		if len(uciFields) > 7 {
-			uci.playMoveSequence(uciFields[7:])
+		var moves []string
+		for !tk.Done() {
+			moves = append(moves, tk.Next())
+		}
+		if err := playMoveSequence(gs, moves); err != nil {
+			return err
 		}
-	} else {
-		uci.invalid(uciFields)
 	}
+	uci.game = gs
+	return nil
 }
 
-func (uci *UCIAdapter) playMoveSequence(uciFields []string) {
-	var move Move
-	if uciFields[0] == "moves" {
-		uciFields = uciFields[1:]
-	}
-	for _, moveStr := range uciFields {
-		move = ParseMove(uci.brd, moveStr)
-		makeMove(uci.brd, move)
+func playMoveSequence(gs *GameState, moves []string) error {
+	for _, moveStr := range moves {
+		move, err := ParseLegalMove(gs.brd, moveStr)
+		if err != nil {
+			return err
+		}
+		gs.MakeMove(move)
 	}
+	return nil
 }
 
 func StartPos() *Board {
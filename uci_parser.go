@@ -0,0 +1,98 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Tokenizer for commands received from the GUI. Tokens are separated by any amount of
+// whitespace. Option names and values may contain spaces, so these are read up to the next
+// keyword rather than as single tokens.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type UCITokenizer struct {
+	tokens []string
+	pos    int
+}
+
+func NewUCITokenizer(input string) *UCITokenizer {
+	return &UCITokenizer{tokens: strings.Fields(input)}
+}
+
+func (tk *UCITokenizer) Done() bool {
+	return tk.pos >= len(tk.tokens)
+}
+
+// Peek returns the next token without consuming it, or "" if no tokens remain.
+func (tk *UCITokenizer) Peek() string {
+	if tk.Done() {
+		return ""
+	}
+	return tk.tokens[tk.pos]
+}
+
+// Next consumes and returns the next token, or "" if no tokens remain.
+func (tk *UCITokenizer) Next() string {
+	token := tk.Peek()
+	if !tk.Done() {
+		tk.pos++
+	}
+	return token
+}
+
+// NextUntil consumes tokens up to but not including the first of the given keywords, and
+// returns them joined by single spaces.
+func (tk *UCITokenizer) NextUntil(keywords ...string) string {
+	start := tk.pos
+	for ; !tk.Done(); tk.pos++ {
+		for _, keyword := range keywords {
+			if tk.tokens[tk.pos] == keyword {
+				return strings.Join(tk.tokens[start:tk.pos], " ")
+			}
+		}
+	}
+	return strings.Join(tk.tokens[start:], " ")
+}
+
+// Int consumes the integer value given for param, which must be at least min.
+func (tk *UCITokenizer) Int(param string, min int) (int, error) {
+	if tk.Done() {
+		return 0, fmt.Errorf("missing value for %s", param)
+	}
+	str := tk.Next()
+	n, err := strconv.Atoi(str)
+	if err != nil || n < min {
+		return 0, fmt.Errorf("invalid value %q for %s", str, param)
+	}
+	return n, nil
+}
+
+// ParseOption reads the remainder of a setoption command:  name <id> [value <x>]
+func (tk *UCITokenizer) ParseOption() (name, value string, err error) {
+	if tk.Next() != "name" {
+		return "", "", fmt.Errorf("expected setoption name <id> [value <x>]")
+	}
+	if name = tk.NextUntil("value"); name == "" {
+		return "", "", fmt.Errorf("missing option name")
+	}
+	if tk.Next() == "value" {
+		value = tk.NextUntil()
+	}
+	return name, value, nil
+}
+
+// parseCheck converts the value of a check option.
+func parseCheck(name, value string) (bool, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid value %q for %s, expected true or false", value, name)
+}
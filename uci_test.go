@@ -0,0 +1,207 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Each transcript is a script of GUI commands, along with lines the engine is expected to send
+// in response. Expected lines are matched by prefix, and must appear in the given order. Like a
+// GUI, a script may "wait" for a line with the given prefix before sending further commands.
+var uciTranscripts = []struct {
+	name, input string
+	expected    []string
+	fen         string // position expected once the transcript completes, if given.
+}{
+	{"handshake", "uci\nisready\n",
+		[]string{"id name GopherCheck", "id author", "option name Clear Hash type button", "uciok", "readyok"}, ""},
+	{"search", "ucinewgame\nposition startpos moves e2e4 e7e5\ngo depth 3\nwait bestmove\nisready\n",
+		[]string{"bestmove", "readyok"}, "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 1"},
+	{"search limits", "position startpos\ngo nodes 500 movetime 1000 wtime -20 btime 1000 winc 0 binc 0\nwait bestmove\nisready\n",
+		[]string{"bestmove", "readyok"}, ""},
+	{"searchmoves", "position startpos\ngo depth 2 searchmoves a2a3 e2e5\nwait bestmove\nisready\n",
+		[]string{"info string ignoring searchmoves entry: illegal move e2e5", "bestmove a2a3", "readyok"}, ""},
+	{"underpromotion searchmoves", "position fen 7k/4P3/8/8/8/8/8/K7 w - - 0 1\ngo depth 3 searchmoves e7e8r\n" +
+		"wait bestmove\ngo depth 3 searchmoves e7e8b\nwait bestmove\n",
+		[]string{"bestmove e7e8r", "bestmove e7e8b"}, ""},
+	// the knight shuffle has already repeated the position after b6a8 twice, so black can claim a
+	// draw despite being a rook down.
+	{"repetition", "position fen n3k3/8/8/8/8/8/8/R3K2N w - - 0 1 moves h1g3 a8b6 g3h1 b6a8 h1g3 a8b6 g3h1\n" +
+		"go depth 6\nwait bestmove\n", []string{"bestmove b6a8"}, ""},
+	{"no legal searchmoves", "position startpos\ngo depth 2 searchmoves e2e5 h2h5\nisready\n",
+		[]string{"info string ignoring searchmoves entry: illegal move e2e5",
+			"info string ignoring searchmoves entry: illegal move h2h5",
+			"info string go: no legal moves given for searchmoves", "readyok"}, ""},
+	{"tokens are separated by any whitespace", "  position \t startpos   moves  d2d4 \nisready\n",
+		[]string{"readyok"}, "rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq d3 0 1"},
+	{"unknown leading tokens are skipped", "joho position fen 8/8/4k3/8/8/4K3/8/8 w - - 0 1\n",
+		nil, "8/8/4k3/8/8/4K3/8/8 w - - 0 1"},
+	{"unknown command", "xyzzy\n", []string{"info string unknown command: xyzzy"}, ""},
+	{"illegal move", "position startpos moves e2e4\nposition startpos moves e2e4 e2e4\n",
+		[]string{"info string position: illegal move e2e4"},
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"},
+	{"malformed position", "position\nposition fen 8/8/8\nposition startpos e2e4\n",
+		[]string{"info string position: expected startpos or fen", "info string position: incomplete FEN",
+			"info string position: expected moves"}, ""},
+	{"invalid FEN", "position fen 8/8/4k3/8/8/4K3/8/8 w - - 0 1\nposition fen xyz w -\n" +
+		"position fen 8/8/8/8/8/8/8/8 w - - 0 1\nposition fen 8/8/4k3/7/8/4K3/8/8 w - - 0 1\n" +
+		"position fen 8/8/4k3/8/8/4K3/8/7X w - - 0 1\nposition fen 8/8/4k3/8/8/4K3/8/8 x - - 0 1\n" +
+		"position fen 8/8/4k3/8/8/4K3/8/8 w Z - 0 1\nposition fen 8/8/4k3/8/8/4K3/8/8 w - e6 0 1\n" +
+		"position fen 4k3/8/8/8/8/8/8/4R1K1 w - - 0 1\nposition fen 4k2P/8/8/8/8/8/8/6K1 b - - 0 1\n",
+		[]string{"info string position: expected 8 ranks", "info string position: expected one black king",
+			"info string position: expected 8 squares on rank 5", "info string position: invalid piece 'X'",
+			"info string position: invalid side to move", "info string position: invalid castling rights",
+			"info string position: invalid en passant target",
+			"info string position: side to move can capture the enemy king",
+			"info string position: pawns on the first or last rank"}, "8/8/4k3/8/8/4K3/8/8 w - - 0 1"},
+	{"malformed go", "go depth\ngo wtime soon\ngo depth 0\ngo sideways\nisready\n",
+		[]string{"info string go: missing value for depth", "info string go: invalid value \"soon\" for wtime",
+			"info string go: invalid value \"0\" for depth", "info string go: unknown parameter \"sideways\"",
+			"readyok"}, ""},
+	{"options", "setoption name clear hash\nsetoption name PONDER value true\nsetoption name Ponder value maybe\n" +
+		"setoption name No Such Option value 3\nsetoption value 3\nsetoption name CPU value 0\n",
+		[]string{"info string setoption: invalid value \"maybe\" for Ponder",
+			"info string setoption: unknown option \"No Such Option\"", "info string setoption: expected setoption name",
+			"info string setoption: invalid value \"0\" for CPU"}, ""},
+	{"debug", "debug\ndebug maybe\n", []string{"info string debug: expected on or off, got \"\"",
+		"info string debug: expected on or off, got \"maybe\""}, ""},
+	{"perft", "position fen 8/8/4k3/8/8/4K3/8/8 w - - 0 1\nperft 1\ndivide 1 threads 2 hash 1\nperft\nperft 1 cores 2\n",
+		[]string{"nodes 8", "e3d2: 1", "nodes 8", "info string perft: missing value for depth",
+			"info string perft: unknown parameter \"cores\""}, ""},
+	{"isready during search", "position startpos\ngo infinite\nisready\nwait readyok\nstop\nwait bestmove\n",
+		[]string{"readyok", "bestmove"}, ""},
+	{"position during search", "position startpos\ngo infinite\nposition startpos moves g1f3\nstop\nwait bestmove\n",
+		[]string{"bestmove"}, "rnbqkbnr/pppppppp/8/8/8/5N2/PPPPPPPP/RNBQKB1R b KQkq - 1 1"},
+	{"idle commands during search", "go infinite\nsetoption name Ponder value true\nucinewgame\ngo depth 1\n" +
+		"perft 1\nstop\nwait bestmove\n",
+		[]string{"info string setoption: not allowed while searching", "info string ucinewgame: not allowed while searching",
+			"info string go: not allowed while searching", "info string perft: not allowed while searching",
+			"bestmove"}, ""},
+	// the result of a ponder search is held until ponderhit, even once the search has finished.
+	{"ponderhit", "setoption name Ponder value true\nposition startpos\ngo ponder depth 1\ngo depth 1\nponderhit\n" +
+		"wait bestmove\n", []string{"info string go: not allowed while searching", "bestmove"}, ""},
+	{"stop while pondering", "setoption name Ponder value true\ngo ponder infinite\nisready\nwait readyok\nstop\n" +
+		"wait bestmove\nisready\n", []string{"readyok", "bestmove", "readyok"}, ""},
+	// having pondered past its share of the clock, the engine moves as soon as ponderhit is received.
+	{"ponderhit with clock", "setoption name Ponder value true\nposition startpos\ngo ponder wtime 1000 btime 1000\n" +
+		"wait info score\nponderhit\nwait bestmove\n", []string{"info score", "bestmove"}, ""},
+	{"search options", "uci\nsetoption name null move pruning value false\nsetoption name Late Move Reductions value false\n" +
+		"setoption name LMR Min Depth value 1\nsetoption name IID Min Depth value 6\nsetoption name Tempo Bonus\n" +
+		"position startpos\ngo depth 4\nwait bestmove\n",
+		[]string{"option name Null Move Pruning type check default true",
+			"option name LMR Min Depth type spin default 2 min 2 max 32", "uciok",
+			"info string setoption: invalid value \"1\" for LMR Min Depth, expected 2 to 32",
+			"info string setoption: invalid value \"\" for Tempo Bonus", "bestmove"}, ""},
+	{"multipv", "setoption name MultiPV value 3\nposition fen 8/8/4k3/8/8/4K3/8/R7 w - - 0 1\ngo depth 4\n" +
+		"wait bestmove\n", []string{"info multipv 1 score", "info multipv 2 score", "info multipv 3 score",
+		"bestmove"}, ""},
+	{"no legal moves", "position fen 7k/5Q2/6K1/8/8/8/8/8 b - - 0 1\ngo depth 5\nwait bestmove\n",
+		[]string{"bestmove 0000"}, ""},
+	{"currmove", "position startpos\ngo infinite\nwait info depth\nstop\nwait bestmove\n",
+		[]string{"info depth", "bestmove"}, ""},
+	{"progress", "position startpos\ngo infinite\nwait info nodes\nstop\nwait bestmove\n",
+		[]string{"info nodes", "bestmove"}, ""},
+	{"quit during search", "go infinite\nquit\n", nil, ""},
+}
+
+func TestUCITranscripts(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer func() { searchConfig = defaultSearchConfig }()
+	for _, transcript := range uciTranscripts {
+		searchConfig = defaultSearchConfig
+		uci, lines := runUCITranscript(t, transcript.name, transcript.input)
+		i := 0
+		for _, line := range lines {
+			if i < len(transcript.expected) && strings.HasPrefix(line, transcript.expected[i]) {
+				i++
+			}
+		}
+		if i < len(transcript.expected) {
+			t.Errorf("%s: expected %q in output:\n%s", transcript.name, transcript.expected[i],
+				strings.Join(lines, "\n"))
+		}
+		if transcript.fen != "" && uci.game.brd.ToFEN() != transcript.fen {
+			t.Errorf("%s: expected position %s, got %s", transcript.name, transcript.fen, uci.game.brd.ToFEN())
+		}
+	}
+}
+
+func TestSearchOptions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer func() { searchConfig = defaultSearchConfig }()
+	runUCITranscript(t, "search options", "setoption name NULL MOVE PRUNING value false\n"+
+		"setoption name IID Min Depth value 6\nsetoption name QSearch Check Depth value -4\n")
+	if searchConfig.nullMove || searchConfig.iidMin != 6 || searchConfig.minCheckDepth != -4 {
+		t.Errorf("expected search options to be set, got %+v", searchConfig)
+	}
+}
+
+// History from earlier searches is kept until the start of a new game.
+func TestNewGameClearsHistory(t *testing.T) {
+	log.SetOutput(io.Discard)
+	uci, _ := runUCITranscript(t, "history", "position startpos\ngo depth 5\nwait bestmove\n")
+	if *uci.htable == (HistoryTable{}) {
+		t.Errorf("expected history to be kept after search")
+	}
+	uci, _ = runUCITranscript(t, "new game", "position startpos\ngo depth 5\nwait bestmove\nucinewgame\n")
+	if *uci.htable != (HistoryTable{}) {
+		t.Errorf("expected history to be cleared by ucinewgame")
+	}
+}
+
+// runUCITranscript sends the script to the engine over a pipe, as a GUI would, and returns the
+// lines sent by the engine once it has shut down.
+func runUCITranscript(t *testing.T, name, script string) (*UCIAdapter, []string) {
+	var out bytes.Buffer
+	uci := NewUCIAdapter()
+	uci.out = &out
+	output := func() []string {
+		uci.outMu.Lock()
+		defer uci.outMu.Unlock()
+		return strings.Split(strings.TrimSpace(out.String()), "\n")
+	}
+	r, w := io.Pipe()
+	done := make(chan bool)
+	go func() {
+		uci.ReadCommands(bufio.NewReader(r))
+		close(done)
+	}()
+	for _, line := range strings.Split(script, "\n") {
+		if prefix := strings.TrimPrefix(line, "wait "); prefix != line {
+			if !waitForLine(output, prefix) {
+				t.Errorf("%s: timed out waiting for %q", name, prefix)
+			}
+		} else if line != "" {
+			w.Write([]byte(line + "\n"))
+		}
+	}
+	w.Close()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s: engine did not shut down", name)
+	}
+	return uci, output()
+}
+
+func waitForLine(output func() []string, prefix string) bool {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		for _, line := range output() {
+			if strings.HasPrefix(line, prefix) {
+				return true
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
@@ -25,7 +25,7 @@ func RunTestSuite(testSuite string, depth, timeout int) {
 	for i, epd := range test {
 		gt = NewGameTimer(0, epd.brd.c)
 		gt.SetMoveTime(time.Duration(timeout) * time.Millisecond)
-		search = NewSearch(SearchParams{depth, false, false, false}, gt, nil, nil)
+		search = NewSearch(SearchParams{depth, false, false}, gt, nil, nil, nil)
 		search.Start(epd.brd)
 
 		moveStr = ToSAN(epd.brd, search.bestMove)
@@ -98,6 +98,10 @@ func CompareBoards(brd, other *Board) bool {
 		fmt.Println("Board.pawnHashKey unequal")
 		equal = false
 	}
+	if brd.materialKey != other.materialKey {
+		fmt.Println("Board.materialKey unequal")
+		equal = false
+	}
 	if brd.c != other.c {
 		fmt.Println("Board.c unequal")
 		equal = false
@@ -106,6 +110,10 @@ func CompareBoards(brd, other *Board) bool {
 		fmt.Println("Board.castle unequal")
 		equal = false
 	}
+	if brd.castleRooks != other.castleRooks {
+		fmt.Println("Board.castleRooks unequal")
+		equal = false
+	}
 	if brd.enpTarget != other.enpTarget {
 		fmt.Println("Board.enpTarget unequal")
 		equal = false
@@ -124,7 +132,8 @@ func CompareBoards(brd, other *Board) bool {
 func isBoardConsistent(brd *Board) bool {
 	var squares [64]Piece
 	var occupied [2]BB
-	var material [2]int16
+	var material [2]Score
+	var materialKey uint32
 
 	var sq int
 	for sq = 0; sq < 64; sq++ {
@@ -142,7 +151,8 @@ func isBoardConsistent(brd *Board) bool {
 
 			for bb := brd.pieces[c][pc]; bb > 0; bb.Clear(sq) {
 				sq = furthestForward(c, bb)
-				material[c] += int16(pc.Value() + mainPst[c][pc][sq])
+				material[c] += materialScores[pc] + mainPst[c][pc][sq]
+				materialKey += materialZobrist(pc, c)
 				if squares[sq] != EMPTY {
 					fmt.Printf("brd.pieces[%d][%d] overlaps with another pieces bitboard at %s.\n", c, pc, SquareString(sq))
 					consistent = false
@@ -164,6 +174,10 @@ func isBoardConsistent(brd *Board) bool {
 		fmt.Println("brd.material inconsistent")
 		consistent = false
 	}
+	if materialKey != brd.materialKey {
+		fmt.Println("brd.materialKey inconsistent")
+		consistent = false
+	}
 
 	return consistent
 }
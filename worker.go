@@ -30,6 +30,7 @@ import (
 // each child SP.
 
 type Worker struct {
+	nodes int64 // nodes visited by this worker, for progress reports. Accessed atomically.
 	sync.RWMutex
 	searchOverhead int
 
@@ -39,13 +40,55 @@ type Worker struct {
 	assignSp chan *SplitPoint
 
 	ptt       *PawnTT
+	mtt       *MaterialTT
 	recycler  *Recycler
 	currentSp *SplitPoint
+	accs      [MAX_STACK]*Accumulator // NNUE accumulator storage, indexed by the ply of each search root.
 
 	mask  uint8
 	index uint8
 }
 
+// Worker indices are stored as a uint8, so no more than MAX_WORKERS can be created.
+const MAX_WORKERS = 256
+
+func NewWorker(index uint8) *Worker {
+	return &Worker{
+		mask:     1 << index,
+		index:    index,
+		spList:   make(SPList, 0, MAX_DEPTH),
+		stk:      NewStack(),
+		ptt:      NewPawnTT(),
+		mtt:      NewMaterialTT(),
+		assignSp: make(chan *SplitPoint, 1),
+		recycler: NewRecycler(512),
+	}
+}
+
+// accumulator returns the worker's accumulator storage for a board at the root of a search from
+// the given ply, allocating it on first use or once a different network has been loaded.
+func (w *Worker) accumulator(ply int, net *Network) *Accumulator {
+	if w.accs[ply] == nil || w.accs[ply].net != net {
+		w.accs[ply] = NewAccumulator(net)
+	}
+	return w.accs[ply]
+}
+
+// copyBoard copies the SP board brd for a search by w rooted at the given ply. A worker only
+// helps at SP nodes below the one it is currently searching, so each ply's accumulator storage is
+// used by at most one board at a time. The SP board keeps an accumulator of its own, since
+// servants may still copy it after its master has moved on.
+func (w *Worker) copyBoard(brd *Board, ply int) *Board {
+	var acc *Accumulator
+	if brd.acc != nil {
+		acc = w.accumulator(ply, brd.acc.net)
+		brd.acc.CopyTo(acc)
+	}
+	cpy := brd.CopyWith(acc)
+	cpy.worker = w
+	return cpy
+}
+
 func (w *Worker) IsCancelled() bool {
 	for sp := w.currentSp; sp != nil; sp = sp.parent {
 		if sp.Cancel() {
@@ -129,11 +172,11 @@ func (w *Worker) Help(b *Balancer) {
 }
 
 func (w *Worker) SearchSP(sp *SplitPoint) {
-	brd := sp.brd.Copy()
-	brd.worker = w
+	brd := w.copyBoard(sp.brd, sp.ply)
 
 	sp.stk.CopyUpTo(w.stk, sp.ply)
 	w.stk[sp.ply].sp = sp
+	w.stk[sp.ply].prevMoves = sp.thisStk.prevMoves
 
 	sp.RLock()
 	alpha, beta := sp.alpha, sp.beta
@@ -11,6 +11,10 @@ package main
 // piece/square combination, and merging in keys representing the side to move, castling rights,
 // and any en-passant target square.
 var pawnZobristTable [2][64]uint32
+
+// The material hash key is the sum of the keys for each piece on the board. Since the key does not
+// depend on piece placement, it identifies the material configuration of a position.
+var materialZobristTable [2][8]uint32
 var zobristTable [2][8][64]uint64
 
 // integer keys representing the en-passant target square, if any.
@@ -36,6 +40,11 @@ func setupZobrist() {
 	}
 	enpTable[64] = 0
 	sideKey64 = rng.RandomUint64(63)
+	for c := 0; c < 2; c++ {
+		for pc := 0; pc < 6; pc++ {
+			materialZobristTable[c][pc] = uint32(rng.rand()) // dense keys, since material keys are summed.
+		}
+	}
 }
 
 func zobrist(pc Piece, sq int, c uint8) uint64 {
@@ -46,6 +55,10 @@ func pawnZobrist(sq int, c uint8) uint32 {
 	return pawnZobristTable[c][sq]
 }
 
+func materialZobrist(pc Piece, c uint8) uint32 {
+	return materialZobristTable[c][pc]
+}
+
 func enpZobrist(sq uint8) uint64 {
 	return enpTable[sq]
 }